@@ -0,0 +1,72 @@
+// Clock skew detection.
+//
+// Codes are only accepted if the local clock is close to the clock of the other
+// side. The offset of the local clock can be found from the Date header of a
+// HTTP server or from a code generated by a device with a known-good clock.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	CLOCK_MAX_OFFSET = 12 * time.Hour // how far clock check searches for a code
+	CLOCK_TIMEOUT    = 10 * time.Second
+)
+
+// Clock returns the current time. Everything that generates or verifies codes takes
+// a clock, so the time can be adjusted for a drifting system clock or fixed in tests
+type Clock func() time.Time
+
+// OffsetClock returns the system clock adjusted with an offset
+func OffsetClock(offset time.Duration) Clock {
+	return func() time.Time {
+		return time.Now().Add(offset)
+	}
+}
+
+// ClockOffsetFromHttp compares the clock with the Date header from a HTTP server.
+// The header only has a resolution of one second, so the result is not more precise than that
+func ClockOffsetFromHttp(url string, clock Clock) (time.Duration, error) {
+	client := &http.Client{Timeout: CLOCK_TIMEOUT}
+
+	start := clock()
+	resp, err := client.Head(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	end := clock()
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("No valid Date header from %s", url)
+	}
+
+	// the header is truncated to seconds and was created somewhere between start and end
+	local := start.Add(end.Sub(start) / 2)
+	offset := date.Add(time.Second / 2).Sub(local)
+	return offset.Round(time.Second), nil
+}
+
+// ClockOffsetFromCode finds the clock offset from a code generated on a device with a known-good clock.
+// The nearest matching time step is used, the result is not more precise than the time step
+func ClockOffsetFromCode(g Generator, code string, now time.Time) (time.Duration, error) {
+	counter := g.Counter(now)
+	from, until := g.Validity(counter)
+	period := until.Sub(from)
+	steps := int64(CLOCK_MAX_OFFSET / period)
+
+	for d := int64(0); d <= steps; d++ {
+		if g.Code(counter+d) == code {
+			return time.Duration(d) * period, nil
+		}
+		if d != 0 && g.Code(counter-d) == code {
+			return -time.Duration(d) * period, nil
+		}
+	}
+	return 0, fmt.Errorf("Code does not match any time within %v of the local clock", CLOCK_MAX_OFFSET)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClockGenerate(t *testing.T) {
+	// RFC 6238 test vector
+	totp := NewTotp([]byte("12345678901234567890"), DEFAULT_PERIOD, 8, sha1.New)
+	reference := time.Unix(1111111109, 0)
+
+	timeleft, code := totp.Generate(reference)
+	if code != "07081804" || timeleft != 1 {
+		t.Errorf("expected 07081804 with 1s left, got %s with %ds", code, timeleft)
+	}
+
+	// a local clock that is 90 seconds behind
+	clock := func() time.Time { return reference.Add(-90 * time.Second) }
+	offset, err := ClockOffsetFromCode(totp, "07081804", clock())
+	if err != nil || offset != 90*time.Second {
+		t.Errorf("expected offset 90s got %v (%v)", offset, err)
+	}
+	offset, err = ClockOffsetFromCode(totp, "07081804", clock().Add(3*time.Hour))
+	if err != nil || offset != -3*time.Hour+90*time.Second {
+		t.Errorf("expected offset -2h58m30s got %v (%v)", offset, err)
+	}
+	if _, err := ClockOffsetFromCode(totp, "07081804", clock().Add(24*time.Hour)); err == nil {
+		t.Errorf("code too far away should not be found")
+	}
+}
+
+func TestClockHttp(t *testing.T) {
+	now := time.Date(2026, 10, 18, 14, 2, 0, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", now.Add(-42*time.Second).Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	offset, err := ClockOffsetFromHttp(server.URL, func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("clock check failed: %v", err)
+	}
+	if offset != -42*time.Second {
+		t.Errorf("expected offset -42s got %v", offset)
+	}
+}
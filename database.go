@@ -2,17 +2,24 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"log"
-	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const (
-	DATABASE_VERSION   uint32 = 1
-	PASSWORD_SALT_SIZE        = 32
+	DATABASE_VERSION     uint32 = 14
+	PASSWORD_SALT_SIZE          = 32
+	DEFAULT_MEMBER              = "owner"
+	DATABASE_MAX_ENTRIES        = 1000 // also limited by MAX_STRINGS, the split storage lists the ids
 )
 
 var (
@@ -21,38 +28,100 @@ var (
 
 // databaseHeader represents the file format database header
 type databaseHeader struct {
-	Magic        [4]byte
-	Version      uint32
+	Magic   [4]byte
+	Version uint32
+}
+
+// legacyHeader is the rest of the header in version 1 and 2, before key slots were added
+type legacyHeader struct {
 	PasswordSalt [PASSWORD_SALT_SIZE]byte
 	Length       uint32
 }
 
 // Database contains all tokens + some other information
 type Database struct {
-	Entries   []*Entry
-	filename  string
-	pass      []byte
-	pass_salt []byte
+	Entries      []*Entry
+	Slots        []*KeySlot
+	ClockOffset  time.Duration // correction for the local clock, see clock check
+	Trash        []*TrashItem
+	TrashDays    uint32 // removed entries are purged after this many days, 0 to keep them
+	Journal      []*JournalRecord
+	JournalStart []byte // the hash before the first record, empty unless old records were dropped
+	Tombstones   []Tombstone
+	filename     string
+	storage      Storage
+	key          []byte   // the content key
+	slot         *KeySlot // the slot that was used to open the database
+	identity     *ecdh.PrivateKey
+	onSave       func() // called once after the next successful save
 }
 
 // CreateDatabase create a new database for the given filename and password,
-// A random password salt is generated when this function is called
+// A random content key is generated when this function is called
 func CreateDatabase(filename, password string) (*Database, error) {
+	db, err := CreateDatabaseInStorage(OpenStorage(filename), password)
+	if err != nil {
+		return nil, err
+	}
+	db.filename = filename
+	return db, nil
+}
+
+// CreateDatabaseInStorage creates a new database that is saved to the given storage
+func CreateDatabaseInStorage(storage Storage, password string) (*Database, error) {
+	key := secureRandom(CONTENT_KEY_SIZE)
+	slot, err := NewPasswordSlot(DEFAULT_MEMBER, []byte(password), key)
+	if err != nil {
+		return nil, err
+	}
+
 	db := &Database{
-		filename:  filename,
-		pass:      []byte(password),
-		pass_salt: secureRandom(PASSWORD_SALT_SIZE),
+		Slots:     []*KeySlot{slot},
+		TrashDays: TRASH_DEFAULT_DAYS,
+		storage:   storage,
+		key:       key,
+		slot:      slot,
 	}
 	return db, nil
 }
 
-// LoadDatabase loads a database from file
+// LoadDatabase loads a database from a file or a directory
 func LoadDatabase(filename, password string) (*Database, error) {
+	db, err := LoadDatabaseFromStorage(OpenStorage(filename), password)
+	if err != nil {
+		return nil, err
+	}
+	db.filename = filename
+	return db, nil
+}
+
+// LoadDatabaseFromStorage loads a database from the given storage
+func LoadDatabaseFromStorage(storage Storage, password string) (*Database, error) {
+	db := &Database{
+		storage: storage,
+	}
+	if err := storage.Load(db, []byte(password), nil); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// LoadDatabaseWithRecoveryKey loads a database from file using the recovery key
+func LoadDatabaseWithRecoveryKey(filename string, recoveryKey []byte) (*Database, error) {
+	recovery, err := ecdh.X25519().NewPrivateKey(recoveryKey)
+	if err != nil {
+		return nil, err
+	}
+	return LoadDatabaseWithIdentity(filename, recovery)
+}
+
+// LoadDatabaseWithIdentity loads a database from file using a member key pair instead of a password
+func LoadDatabaseWithIdentity(filename string, identity *ecdh.PrivateKey) (*Database, error) {
 	db := &Database{
 		filename: filename,
-		pass:     []byte(password),
+		storage:  OpenStorage(filename),
 	}
-	if err := db.load(); err != nil {
+	if err := db.storage.Load(db, nil, identity); err != nil {
 		return nil, err
 	}
 	return db, nil
@@ -63,45 +132,196 @@ func (db *Database) Add(entry *Entry) error {
 	if db.findExact(entry.Name) != nil {
 		return fmt.Errorf("Item '%s' already exists, remove it first", entry.Name)
 	}
+	if err := db.checkRoom(1); err != nil {
+		return err
+	}
 
+	db.assignId(entry)
+	if entry.Modified == 0 {
+		entry.Modified = entry.Added
+	}
 	db.Entries = append(db.Entries, entry)
+	db.Record(JOURNAL_ADD, entry)
 	return nil
 }
 
-// Delete removes an entry from the database (but doesn't save it)
-func (db *Database) Delete(name string) *Entry {
-	entries, err := db.Find(name)
-	if err != nil || len(entries) != 1 {
-		fmt.Printf("Could not select unique item '%s'\n", name)
-	} else if len(entries) == 1 {
-		e1 := entries[0]
-		for i, e := range db.Entries {
-			if e == e1 {
-				db.Entries = append(db.Entries[:i], db.Entries[i+1:]...)
-				return e
-			}
+// checkRoom fails if n more entries would not fit in the database
+func (db *Database) checkRoom(n int) error {
+	if len(db.Entries)+n > DATABASE_MAX_ENTRIES {
+		return fmt.Errorf("The database can't hold more than %d items", DATABASE_MAX_ENTRIES)
+	}
+	return nil
+}
+
+// assignId gives the entry a new id if it has none or if another entry already uses it
+func (db *Database) assignId(entry *Entry) {
+	for entry.Id == "" || db.findId(entry.Id, entry) {
+		entry.Id = newEntryId()
+	}
+}
+
+// findId checks if an entry other than the given one has the id
+func (db Database) findId(id string, entry *Entry) bool {
+	for _, e := range db.Entries {
+		if e != entry && e.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Move moves an entry to a position, starting from 1, which changes the #N index of the entries in between
+func (db *Database) Move(entry *Entry, position int) error {
+	if position < 1 || position > len(db.Entries) {
+		return fmt.Errorf("Invalid position %d, must be 1 to %d", position, len(db.Entries))
+	}
+	var entries []*Entry
+	for _, e := range db.Entries {
+		if e != entry {
+			entries = append(entries, e)
+		}
+	}
+	if len(entries) == len(db.Entries) {
+		return fmt.Errorf("'%s' is not in the database", entry.Name)
+	}
+	entries = append(entries[:position-1], append([]*Entry{entry}, entries[position-1:]...)...)
+	db.Entries = entries
+	db.Record(JOURNAL_MOVE, entry)
+	return nil
+}
+
+// EntryChanges are the changes made by Edit, nil fields are not changed
+type EntryChanges struct {
+	Name   *string
+	Note   *string
+	Issuer *string
+	Folder *string
+	Hash   *string
+	Period *int
+	Digits *int
+}
+
+// Edit changes an entry in place (but doesn't save it). The changes are checked
+// like in NewEntry, and a new name must not be used by another entry
+func (db *Database) Edit(entry *Entry, changes EntryChanges) error {
+	e := *entry
+	if changes.Name != nil {
+		if *changes.Name == "" {
+			return fmt.Errorf("Name cannot be empty")
 		}
+		if other := db.findExact(*changes.Name); other != nil && other != entry {
+			return fmt.Errorf("Item '%s' already exists, remove it first", *changes.Name)
+		}
+		e.Name = *changes.Name
+	}
+	if changes.Note != nil {
+		e.Note = *changes.Note
+	}
+	if changes.Issuer != nil {
+		e.Issuer = *changes.Issuer
+	}
+	if changes.Folder != nil {
+		e.Folder = cleanFolder(*changes.Folder)
 	}
+
+	if changes.Hash != nil || changes.Period != nil || changes.Digits != nil {
+		if !e.Editable() {
+			return fmt.Errorf("The algorithm, period and digits of '%s' can't be changed", e.Name)
+		}
+
+		hashname, period, digits := hashToName(e.Hash), int(e.Period), int(e.Digits)
+		if changes.Hash != nil {
+			hashname = *changes.Hash
+		}
+		if changes.Period != nil {
+			period = *changes.Period
+		}
+		if changes.Digits != nil {
+			digits = *changes.Digits
+		}
+		hash, err := checkParameters(hashname, period, digits)
+		if err != nil {
+			return err
+		}
+		e.Hash, e.Period, e.Digits = hash, uint16(period), uint8(digits)
+	}
+
+	e.touch()
+	*entry = e
+	db.Record(JOURNAL_EDIT, entry)
 	return nil
 }
 
-// Find will try to find an entry, either by index, exact name or fuzzy search
+// Find will try to find an entry, either by index, id prefix, exact name or fuzzy search.
+// The search can be narrowed with "tag:X", "folder:X" and "issuer:X" terms,
+// if there are only such terms all matching entries are returned
 func (db Database) Find(name string) ([]*Entry, error) {
+	matches, err := db.Search(name)
+	if err != nil {
+		return nil, err
+	}
+	var ret []*Entry
+	for _, m := range matches {
+		ret = append(ret, m.Entry)
+	}
+	return ret, nil
+}
+
+// Search is like Find but also returns how well each entry matched, best first.
+// Index, id and exact matches are the only match
+func (db Database) Search(name string) ([]Match, error) {
+	if name == "" {
+		return nil, fmt.Errorf("No entry named ''")
+	}
 	if entry, err := db.findIndex(name); err != nil {
 		return nil, err
 	} else if entry != nil {
-		return []*Entry{entry}, nil
+		return []Match{{Entry: entry, Score: SCORE_EXACT}}, nil
+	}
+	if entry, err := db.findIdPrefix(name); err != nil {
+		return nil, err
+	} else if entry != nil {
+		return []Match{{Entry: entry, Score: SCORE_EXACT}}, nil
+	}
+
+	if filtered, rest, ok := db.filter(name); ok {
+		if rest == "" {
+			var ret []Match
+			for _, e := range filtered.Entries {
+				ret = append(ret, Match{Entry: e})
+			}
+			return ret, nil
+		}
+		db, name = filtered, rest
 	}
 	if entry := db.findExact(name); entry != nil {
-		return []*Entry{entry}, nil
+		return []Match{{Entry: entry, Score: SCORE_EXACT}}, nil
 	}
 
 	return db.findFuzzy(name), nil
 }
 
+// FindExact finds one entry by index "#<number>", id prefix "@<hex>" or exact name,
+// without fuzzy matching. Used when a wrong match would accept a code for the wrong account
+func (db Database) FindExact(name string) (*Entry, error) {
+	if name == "" {
+		return nil, fmt.Errorf("Missing entry name")
+	}
+	if entry, err := db.findIndex(name); entry != nil || err != nil {
+		return entry, err
+	}
+	if entry, err := db.findIdPrefix(name); entry != nil || err != nil {
+		return entry, err
+	}
+	if entry := db.findExact(name); entry != nil {
+		return entry, nil
+	}
+	return nil, fmt.Errorf("No entry named '%s'", name)
+}
+
 // findIndex will find entry from index in format "#<number"
 func (db Database) findIndex(name string) (*Entry, error) {
-	if name[0] != '#' {
+	if !strings.HasPrefix(name, "#") {
 		return nil, nil
 	}
 	idx, err := strconv.ParseInt(name[1:], 10, 32)
@@ -115,6 +335,66 @@ func (db Database) findIndex(name string) (*Entry, error) {
 	return db.Entries[n], nil
 }
 
+// findIdPrefix will find entry from a unique id prefix in format "@<hex>"
+func (db Database) findIdPrefix(name string) (*Entry, error) {
+	if !strings.HasPrefix(name, "@") {
+		return nil, nil
+	}
+	prefix := strings.ToLower(name[1:])
+	if prefix == "" {
+		return nil, fmt.Errorf("Missing id after '@'")
+	}
+
+	var found *Entry
+	for _, e := range db.Entries {
+		if strings.HasPrefix(e.Id, prefix) {
+			if found != nil {
+				return nil, fmt.Errorf("Id %s is not unique, use more characters", name)
+			}
+			found = e
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("Entry %s does not exist", name)
+	}
+	return found, nil
+}
+
+// filter removes the qualifier terms from the search and returns the entries matching
+// all of them together with the rest of the search. ok is false if there were no qualifiers
+func (db Database) filter(search string) (filtered Database, rest string, ok bool) {
+	filtered.Entries = db.Entries
+	var others []string
+	for _, term := range strings.Fields(search) {
+		qualifier, value, found := strings.Cut(term, ":")
+		var match func(e *Entry) bool
+		switch strings.ToLower(qualifier) {
+		case "tag":
+			match = func(e *Entry) bool { return e.HasTag(value) }
+		case "folder":
+			match = func(e *Entry) bool { return e.InFolder(value) }
+		case "issuer":
+			match = func(e *Entry) bool {
+				return strings.Contains(strings.ToLower(e.Issuer), strings.ToLower(value))
+			}
+		}
+		if !found || match == nil {
+			others = append(others, term)
+			continue
+		}
+
+		ok = true
+		var matching []*Entry
+		for _, e := range filtered.Entries {
+			if match(e) {
+				matching = append(matching, e)
+			}
+		}
+		filtered.Entries = matching
+	}
+	return filtered, strings.Join(others, " "), ok
+}
+
 // findExact will search for a token with this exact name
 func (db Database) findExact(name string) *Entry {
 	name = strings.ToLower(name)
@@ -127,50 +407,137 @@ func (db Database) findExact(name string) *Entry {
 	return nil
 }
 
-// findFuzzy will find a token with similar name.
-// Currently this is done by a simple substring search
-func (db Database) findFuzzy(name string) []*Entry {
-	name = strings.ToLower(name)
+// findFuzzy will find tokens with a similar name, issuer, tag or note, best first
+func (db Database) findFuzzy(name string) []Match {
+	return rank(db.Entries, name)
+}
 
-	var ret []*Entry
-	for _, e := range db.Entries {
-		if strings.Contains(strings.ToLower(e.Name), name) {
-			ret = append(ret, e)
+// container is the unencrypted part of a database file: the header, the key
+// slots and the encrypted payload
+type container struct {
+	version uint32
+	legacy  legacyHeader // version 1 and 2 only
+	slots   []*KeySlot
+	enc     []byte
+}
+
+// readContainer reads the header, the key slots and the encrypted payload
+func readContainer(r io.Reader) (*container, error) {
+	// 1. load the header
+	var hdr databaseHeader
+	if err := binary.Read(r, BYTE_ORDER, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Magic != DATABASE_MAGIC {
+		return nil, fmt.Errorf("Invalid database file")
+	}
+	if hdr.Version < 1 || hdr.Version > DATABASE_VERSION {
+		return nil, fmt.Errorf("Invalid database version: %d", hdr.Version)
+	}
+
+	// 2. read the key slots and the encrypted data, version 1 and 2 had a single password salt instead
+	c := &container{version: hdr.Version}
+	var err error
+	if hdr.Version < 3 {
+		if err := binary.Read(r, BYTE_ORDER, &c.legacy); err != nil {
+			return nil, err
+		}
+		if c.enc, err = ReadExact(r, int(c.legacy.Length)); err != nil {
+			return nil, err
+		}
+	} else {
+		if c.slots, err = readSlots(r); err != nil {
+			return nil, err
+		}
+		if c.enc, err = ReadSized(r, BYTE_ORDER); err != nil {
+			return nil, err
 		}
 	}
-	return ret
+	return c, nil
 }
 
-// load will attempt to load the database from file
-func (db *Database) load() error {
-	r1, err := os.Open(db.filename)
-	if err != nil {
+// writeContainer writes the header, the key slots and the encrypted payload
+func writeContainer(w io.Writer, slots []*KeySlot, enc []byte) error {
+	hdr := databaseHeader{
+		Magic:   DATABASE_MAGIC,
+		Version: DATABASE_VERSION,
+	}
+	if err := binary.Write(w, BYTE_ORDER, &hdr); err != nil {
 		return err
 	}
-	defer r1.Close()
-
-	// 1. load the header
-	var hdr databaseHeader
-	if err := binary.Read(r1, BYTE_ORDER, &hdr); err != nil {
+	if err := writeSlots(w, slots); err != nil {
 		return err
 	}
-	if hdr.Magic != DATABASE_MAGIC {
-		return fmt.Errorf("Invalid database file")
+	return WriteSized(w, BYTE_ORDER, enc)
+}
+
+// readEntries reads the entries at the start of the payload, the storage decides
+// if the entries are stored there or somewhere else
+type readEntries func(r io.Reader, version uint32, key []byte) ([]*Entry, error)
+
+// writeEntries is the counterpart of readEntries
+type writeEntries func(w io.Writer, entries []*Entry) error
+
+// readInlineEntries reads entries stored in the payload
+func readInlineEntries(r io.Reader, version uint32, key []byte) ([]*Entry, error) {
+	var count uint32
+	if err := binary.Read(r, BYTE_ORDER, &count); err != nil {
+		return nil, err
 	}
-	if hdr.Version != DATABASE_VERSION {
-		return fmt.Errorf("Invalid database version: %d", hdr.Version)
+
+	if count > DATABASE_MAX_ENTRIES {
+		return nil, fmt.Errorf("Too many items in database: %d", count)
 	}
 
-	// 2. read the encrypted data
-	enc, err := ReadExact(r1, int(hdr.Length))
-	if err != nil {
+	var entries []*Entry
+	for i := 0; i < int(count); i++ {
+		entry := &Entry{}
+		if err := entry.Deserial(r, version); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// writeInlineEntries writes the entries in the payload
+func writeInlineEntries(w io.Writer, entries []*Entry) error {
+	if err := binary.Write(w, BYTE_ORDER, uint32(len(entries))); err != nil {
 		return err
 	}
+	for _, entry := range entries {
+		if err := entry.Serial(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	// 3. decrpyt data
-	key := GenerateKeyFromPassword(db.pass, hdr.PasswordSalt[:])
+// open unlocks the container and loads the payload into the database
+func (db *Database) open(c *container, password []byte, identity *ecdh.PrivateKey, read readEntries) error {
+	// 3. find the content key and decrpyt data
+	var key []byte
+	var slot *KeySlot
+	slots := c.slots
+	reload := db.key != nil
+	if c.version < 3 {
+		key = GenerateKeyFromPassword(password, c.legacy.PasswordSalt[:])
+	} else if reload {
+		// the database is already open and the content key is known, see Update
+		key = db.key
+		for _, s := range slots {
+			if db.slot != nil && s.Name == db.slot.Name {
+				slot = s
+			}
+		}
+	} else {
+		key, slot = unlockSlots(slots, password, identity)
+	}
 
-	dec, err := decryptBytes(key, enc)
+	dec, err := decryptBytes(key, c.enc) // this also fails if no slot could be unlocked
+	if err != nil && reload {
+		return fmt.Errorf("The database key was changed by another process, open it again")
+	}
 	if err != nil {
 		// the reason we don't return and error and instead terminate is that if password
 		// was incorrect, we may end up creating a new one (with the bad password) and
@@ -178,77 +545,175 @@ func (db *Database) load() error {
 		log.Fatalf("Unable to decrypt database. Check your password!\n")
 	}
 
-	// 4. read the items from the decrypted buffer, start with number of enteries
+	// 4. read the items from the decrypted buffer, start with the entries
 	r2 := bytes.NewBuffer(dec)
 
-	var count uint32
-	if err := binary.Read(r2, BYTE_ORDER, &count); err != nil {
+	// 5.a load each entry
+	entries, err := read(r2, c.version, key)
+	if err != nil {
 		return err
 	}
+	// 5.b version 2 added the personal key pair
+	var personal *ecdh.PrivateKey
+	if c.version >= 2 {
+		var raw []byte
+		if err := ReadOne(r2, BYTE_ORDER, &raw); err != nil {
+			return err
+		}
+		if len(raw) != 0 {
+			if personal, err = ecdh.X25519().NewPrivateKey(raw); err != nil {
+				return err
+			}
+		}
+	}
 
-	if count > 1000 {
-		return fmt.Errorf("Too many items in database: %d", count)
+	// 5.c version 7 added the clock offset
+	var offset int64
+	if c.version >= 7 {
+		if err := ReadOne(r2, BYTE_ORDER, &offset); err != nil {
+			return err
+		}
 	}
 
-	// 5.a load each entry
-	var entries []*Entry
-	for i := 0; i < int(count); i++ {
-		entry := &Entry{}
-		if err := entry.Deserial(r2); err != nil {
+	// 5.d version 12 added the trash
+	trashDays, trash := uint32(TRASH_DEFAULT_DAYS), []*TrashItem(nil)
+	if c.version >= 12 {
+		if trashDays, trash, err = readTrash(r2, c.version); err != nil {
+			return err
+		}
+	}
+
+	// 5.e version 13 added the journal
+	var journalStart []byte
+	var journal []*JournalRecord
+	if c.version >= 13 {
+		if journalStart, journal, err = readJournal(r2); err != nil {
+			return err
+		}
+	}
+
+	// 5.f version 14 added the tombstones
+	var tombstones []Tombstone
+	if c.version >= 14 {
+		if tombstones, err = readTombstones(r2); err != nil {
 			return err
 		}
-		entries = append(entries, entry)
+	}
+
+	// 5.g entries before version 11 had no id, derive one from the key so that
+	// it stays the same until the database is saved
+	for _, e := range entries {
+		if e.Id == "" {
+			mac := hmac.New(sha256.New, key)
+			WriteMultiple(mac, BYTE_ORDER, e.Added, e.Name, e.Secret)
+			e.Id = hex.EncodeToString(mac.Sum(nil)[:ENTRY_ID_SIZE])
+		}
+	}
+
+	// 6. version 1 and 2 used the password key directly, move to a content key in a password slot
+	if c.version < 3 {
+		key = secureRandom(CONTENT_KEY_SIZE)
+		if slot, err = NewPasswordSlot(DEFAULT_MEMBER, password, key); err != nil {
+			return err
+		}
+		slots = []*KeySlot{slot}
 	}
 
 	// all data was loaded, update the database
-	db.pass_salt = hdr.PasswordSalt[:]
 	db.Entries = entries
+	db.Slots = slots
+	db.key = key
+	db.slot = slot
+	db.identity = personal
+	db.ClockOffset = time.Duration(offset)
+	db.Trash = trash
+	db.TrashDays = trashDays
+	db.Journal = journal
+	db.JournalStart = journalStart
+	db.Tombstones = tombstones
+	db.purgeExpired(time.Now())
 
 	return nil
 }
 
-// Save will write the database to file
-func (db Database) Save() error {
-	key := GenerateKeyFromPassword(db.pass, db.pass_salt)
+// Save will write the database to its storage. It fails instead of overwriting the
+// changes if another process saved the database after it was loaded
+func (db *Database) Save() error {
+	unlock, err := db.storage.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-	// 1. write items to a plaintext buffer, start with item count
-	plain := new(bytes.Buffer)
-	if err := binary.Write(plain, BYTE_ORDER, uint32(len(db.Entries))); err != nil {
+	if changed, err := db.storage.Changed(); err != nil {
 		return err
+	} else if changed {
+		return fmt.Errorf("The database was changed by another process, run the command again")
 	}
+	return db.save()
+}
 
-	for _, entry := range db.Entries {
-		if err := entry.Serial(plain); err != nil {
+// Update makes a change and saves it while holding the storage lock. If another
+// process saved the database after it was loaded it is reloaded before the change
+func (db *Database) Update(change func() error) error {
+	unlock, err := db.storage.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if changed, err := db.storage.Changed(); err != nil {
+		return err
+	} else if changed {
+		if err := db.storage.Load(db, nil, nil); err != nil {
 			return err
 		}
 	}
-
-	// 2. encrypt the entire buffer
-	enc, err := encryptBytes(key, plain.Bytes())
-	if err != nil {
+	if err := change(); err != nil {
 		return err
 	}
+	return db.save()
+}
 
-	// 3. open file and write the header to it
-	f, err := os.OpenFile(db.filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
+func (db *Database) save() error {
+	if err := db.storage.Save(db); err != nil {
 		return err
 	}
-	defer f.Close()
+	if onSave := db.onSave; onSave != nil {
+		db.onSave = nil
+		onSave()
+	}
+	return nil
+}
 
-	// write header to file
-	hdr := databaseHeader{
-		Magic:   DATABASE_MAGIC,
-		Version: DATABASE_VERSION,
-		Length:  uint32(len(enc)),
+// seal writes the payload and encrypts it, the entries are written by the storage
+func (db Database) seal(write writeEntries) ([]byte, error) {
+	// 1. write items to a plaintext buffer, start with the entries
+	plain := new(bytes.Buffer)
+	if err := write(plain, db.Entries); err != nil {
+		return nil, err
 	}
-	// ah golang...
-	copy(hdr.PasswordSalt[:], db.pass_salt)
 
-	if err := binary.Write(f, BYTE_ORDER, &hdr); err != nil {
-		return err
+	var identity []byte
+	if db.identity != nil {
+		identity = db.identity.Bytes()
+	}
+	if err := WriteOne(plain, BYTE_ORDER, identity); err != nil {
+		return nil, err
+	}
+	if err := WriteOne(plain, BYTE_ORDER, int64(db.ClockOffset)); err != nil {
+		return nil, err
+	}
+	if err := writeTrash(plain, db.TrashDays, db.Trash); err != nil {
+		return nil, err
+	}
+	if err := writeJournal(plain, db.JournalStart, db.Journal); err != nil {
+		return nil, err
+	}
+	if err := writeTombstones(plain, db.Tombstones); err != nil {
+		return nil, err
 	}
 
-	// 4. add the encrypted data
-	return WriteExact(f, enc)
+	// 2. encrypt the entire buffer
+	return encryptBytes(db.key, plain.Bytes())
 }
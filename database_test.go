@@ -2,7 +2,10 @@ package main
 
 import (
 	"log"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func add(db *Database, name, secret string) *Entry {
@@ -78,3 +81,198 @@ func TestDatabaseSearch(t *testing.T) {
 	}
 
 }
+
+func TestDatabaseSaveLoad(t *testing.T) {
+	filename := t.TempDir() + "/test.tokdb"
+
+	db1 := ensure(CreateDatabase(filename, "password"))
+	e1 := add(db1, "entry 1", "NZSXMZLSEBTW63TOME")
+	e1.Folder, e1.Tags = "work/aws", []string{"prod", "oncall"}
+	add(db1, "entry 2", "M5UXMZJAPFXXKIDVOA")
+	db1.identity = ensure(GenerateIdentity())
+	db1.ClockOffset = -90 * time.Second
+	if err := db1.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	db2, err := LoadDatabase(filename, "password")
+	if err != nil {
+		t.Fatalf("Unable to load database: %v", err)
+	}
+	if len(db2.Entries) != 2 || !reflect.DeepEqual(db2.Entries, db1.Entries) {
+		t.Errorf("Loaded entries differ: %v vs %v", db2.Entries, db1.Entries)
+	}
+	if db2.identity == nil || !db2.identity.Equal(db1.identity) {
+		t.Errorf("Loaded key pair differs")
+	}
+	if db2.ClockOffset != db1.ClockOffset {
+		t.Errorf("Loaded clock offset differs: %v vs %v", db2.ClockOffset, db1.ClockOffset)
+	}
+}
+
+func TestDatabaseEdit(t *testing.T) {
+	db := &Database{}
+	e1 := add(db, "github", "NZSXMZLSEBTW63TOME")
+	add(db, "gitlab", "M5UXMZJAPFXXKIDVOA")
+	added := e1.Added
+
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+
+	if err := db.Edit(e1, EntryChanges{Name: str("GitHub"), Note: str("work"), Period: num(60)}); err != nil {
+		t.Fatalf("Edit failed: %v", err)
+	}
+	if e1.Name != "GitHub" || e1.Note != "work" || e1.Period != 60 || e1.Added != added || db.Entries[0] != e1 {
+		t.Errorf("Unexpected entry after edit: %+v", e1)
+	}
+
+	// invalid changes are rejected and nothing is changed
+	for _, changes := range []EntryChanges{
+		{Name: str("GITLAB")},
+		{Name: str("")},
+		{Note: str("changed"), Digits: num(12)},
+		{Hash: str("md5")},
+		{Period: num(0)},
+	} {
+		if err := db.Edit(e1, changes); err == nil {
+			t.Errorf("Edit %+v should fail", changes)
+		}
+	}
+	if e1.Name != "GitHub" || e1.Note != "work" || e1.Digits != DEFAULT_DIGITS {
+		t.Errorf("Failed edit changed the entry: %+v", e1)
+	}
+
+	steam := ensure(NewSteamEntry("steam", "MTIzNDU2Nzg5MDEyMzQ1Njc4OTA="))
+	db.Add(steam)
+	if err := db.Edit(steam, EntryChanges{Digits: num(6)}); err == nil {
+		t.Errorf("Steam digits should not be editable")
+	}
+}
+
+func TestDatabaseFindExact(t *testing.T) {
+	db := &Database{}
+	bob := add(db, "bob", "NZSXMZLSEBTW63TOME")
+	bob.Note = "alice backup"
+	add(db, "alice-old", "M5UXMZJAPFXXKIDVOA")
+
+	// the fuzzy search finds bob through the note, FindExact must not
+	if _, err := db.FindExact("alice"); err == nil {
+		t.Errorf("FindExact matched a name that only appears in a note")
+	}
+	if e, err := db.FindExact("bob"); err != nil || e != bob {
+		t.Errorf("FindExact failed on exact name: %v %v", e, err)
+	}
+	if e, err := db.FindExact("#1"); err != nil || e != bob {
+		t.Errorf("FindExact failed on index: %v %v", e, err)
+	}
+	if e, err := db.FindExact("@" + bob.Id[:6]); err != nil || e != bob {
+		t.Errorf("FindExact failed on id: %v %v", e, err)
+	}
+	if _, err := db.FindExact(""); err == nil {
+		t.Errorf("FindExact accepted an empty name")
+	}
+}
+
+func TestDatabaseFindQualifiers(t *testing.T) {
+	db := &Database{}
+	aws := add(db, "aws prod", "NZSXMZLSEBTW63TOME")
+	aws.Folder, aws.Issuer, aws.Tags = "work/aws", "Amazon", []string{"prod"}
+	dev := add(db, "aws dev", "M5UXMZJAPFXXKIDVOA")
+	dev.Folder, dev.Issuer = "work/aws/dev", "Amazon"
+	mail := add(db, "mail", "NZSXMZLSEBTW63TOME")
+	mail.Folder, mail.Tags = "home", []string{"Prod"}
+
+	tests := []struct {
+		search string
+		want   []*Entry
+	}{
+		{"tag:prod", []*Entry{aws, mail}},
+		{"tag:PROD aws", []*Entry{aws}},
+		{"folder:work", []*Entry{aws, dev}},
+		{"folder:work/aws/dev", []*Entry{dev}},
+		{"folder:wor", nil},
+		{"issuer:amaz dev", []*Entry{dev}},
+		{"folder:home tag:prod", []*Entry{mail}},
+		{"tag:none", nil},
+		{"aws", []*Entry{aws, dev}},
+	}
+	for _, test := range tests {
+		got, err := db.Find(test.search)
+		if err != nil {
+			t.Errorf("Find '%s' failed: %v", test.search, err)
+		} else if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Find '%s' returned %v, wanted %v", test.search, got, test.want)
+		}
+	}
+}
+
+func TestEntryTags(t *testing.T) {
+	db := &Database{}
+	e := add(db, "entry", "NZSXMZLSEBTW63TOME")
+
+	if err := e.AddTag("prod"); err != nil {
+		t.Errorf("Failed to add tag: %v", err)
+	}
+	if err := e.AddTag("PROD"); err == nil {
+		t.Errorf("Duplicate tag was added")
+	}
+	if err := e.AddTag("two words"); err == nil {
+		t.Errorf("Invalid tag was added")
+	}
+	if !e.HasTag("Prod") {
+		t.Errorf("Tag was not found")
+	}
+	if err := e.RemoveTag("prod"); err != nil || len(e.Tags) != 0 {
+		t.Errorf("Failed to remove tag: %v %v", err, e.Tags)
+	}
+	if err := e.RemoveTag("prod"); err == nil {
+		t.Errorf("Missing tag was removed")
+	}
+
+	if folder := cleanFolder("/work//aws/ "); folder != "work/aws" {
+		t.Errorf("Wrong folder: '%s'", folder)
+	}
+}
+
+func TestDatabaseIds(t *testing.T) {
+	db := &Database{}
+	e1 := add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+	e2 := add(db, "entry 2", "M5UXMZJAPFXXKIDVOA")
+	e3 := &Entry{Name: "entry 3", Id: e1.Id}
+	db.Add(e3)
+
+	if len(e1.Id) != 2*ENTRY_ID_SIZE || e1.Id == e2.Id || e3.Id == e1.Id {
+		t.Fatalf("Ids are not unique: %s %s %s", e1.Id, e2.Id, e3.Id)
+	}
+	if ss, err := db.Find("@" + e2.Id[:6]); err != nil || len(ss) != 1 || ss[0] != e2 {
+		t.Errorf("Find by id prefix failed: %v", err)
+	}
+	if ss, err := db.Find("@" + strings.ToUpper(e3.Id)); err != nil || len(ss) != 1 || ss[0] != e3 {
+		t.Errorf("Find by full id failed: %v", err)
+	}
+	if _, err := db.Find("@"); err == nil {
+		t.Errorf("Empty id was accepted")
+	}
+	e2.Id = "ab" + e2.Id[2:]
+	e3.Id = "ab" + e3.Id[2:]
+	if _, err := db.Find("@ab"); err == nil {
+		t.Errorf("Ambiguous id was accepted")
+	}
+
+	// moving changes the index but not the id
+	if err := db.Move(e3, 1); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if db.Entries[0] != e3 || db.Entries[1] != e1 || db.Entries[2] != e2 {
+		t.Errorf("Wrong order after move: %v", db.Entries)
+	}
+	if ss, err := db.Find("#1"); err != nil || ss[0] != e3 {
+		t.Errorf("Index did not follow the move")
+	}
+	if err := db.Move(e3, 3); err != nil || db.Entries[2] != e3 || db.Entries[0] != e1 {
+		t.Errorf("Move to end failed: %v %v", err, db.Entries)
+	}
+	if err := db.Move(e3, 4); err == nil {
+		t.Errorf("Move past the end was accepted")
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"crypto"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"math"
+	"strings"
 	"time"
 )
 
 // Entry represents one item in the database
 type Entry struct {
+	// Id is random and doesn't change, unlike the position of the entry
+	Id     string
 	Added  int64
 	Period uint16
 	Digits uint8
@@ -16,8 +21,34 @@ type Entry struct {
 	Name   string
 	Secret string
 	Note   string
+	// Counter is the last accepted counter in Verify for time-based entries, to prevent
+	// replays, or the next counter to use for HOTP and OCRA entries
+	Counter int64
+	// Pin is an optional static PIN that must precede the code in password+OTP logins
+	Pin    string
+	Issuer string
+	// Type is the code algorithm, empty for plain TOTP
+	Type string
+	// Suite is the OCRA suite for OCRA entries
+	Suite string
+	// Folder is a path such as "work/aws", empty if the entry is not in a folder
+	Folder string
+	Tags   []string
+	// Modified is the time of the last change in microseconds, used when merging databases
+	Modified int64
 }
 
+const (
+	ENTRY_TOTP   = ""
+	ENTRY_HOTP   = "hotp"
+	ENTRY_STEAM  = "steam"
+	ENTRY_OCRA   = "ocra"
+	ENTRY_MOTP   = "motp"
+	ENTRY_YANDEX = "yandex"
+
+	ENTRY_ID_SIZE = 8 // bytes, shown as hex
+)
+
 // NewEntry creates a new entry from given data, sanity checks period, digits, secret and hashname
 func NewEntry(name, secret, hashname, note string, period, digits int) (*Entry, error) {
 	// check secret:
@@ -25,23 +56,64 @@ func NewEntry(name, secret, hashname, note string, period, digits int) (*Entry,
 		return nil, fmt.Errorf("Invalid secret: %v", err)
 	}
 
+	hash, err := checkParameters(hashname, period, digits)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Entry{
+		Added:  time.Now().UnixMicro(),
+		Period: uint16(period),
+		Digits: uint8(digits),
+		Hash:   hash,
+		Name:   name,
+		Secret: secret,
+		Note:   note,
+	}, nil
+}
+
+// checkParameters sanity checks hashname, period and digits, returns the hash
+func checkParameters(hashname string, period, digits int) (crypto.Hash, error) {
 	// check hash
 	hash, err := hashFromName(hashname)
 	if err != nil {
-		return nil, fmt.Errorf("Invalid algorithm: %v", err)
+		return 0, fmt.Errorf("Invalid algorithm: %v", err)
 	}
 
 	// check period
-	if period < 1 {
-		return nil, fmt.Errorf("Invalid period: %v", period)
+	if period < 1 || period > math.MaxUint16 {
+		return 0, fmt.Errorf("Invalid period: %v", period)
 	}
 
 	// check digits
 	if digits < 1 || digits > 9 {
-		return nil, fmt.Errorf("Invalid digits: %v", digits)
+		return 0, fmt.Errorf("Invalid digits: %v", digits)
 	}
+	return hash, nil
+}
 
-	return &Entry{
+// NewTypedEntry creates an entry of a registered type. The parameters of the type
+// replace the given ones, the secret is in the format the type expects
+func NewTypedEntry(entryType, name, secret, hashname, note, pin string, period, digits int) (*Entry, error) {
+	t, err := generatorType(entryType)
+	if err != nil {
+		return nil, err
+	}
+	if t.Period != 0 {
+		period = t.Period
+	}
+	if t.Digits != 0 {
+		digits = t.Digits
+	}
+	hash, err := checkParameters(hashname, period, digits)
+	if err != nil {
+		return nil, err
+	}
+	if t.Hash != 0 {
+		hash = t.Hash
+	}
+
+	e := &Entry{
 		Added:  time.Now().UnixMicro(),
 		Period: uint16(period),
 		Digits: uint8(digits),
@@ -49,31 +121,185 @@ func NewEntry(name, secret, hashname, note string, period, digits int) (*Entry,
 		Name:   name,
 		Secret: secret,
 		Note:   note,
-	}, nil
+		Pin:    pin,
+		Type:   entryType,
+	}
+
+	// creating the generator checks the secret and PIN
+	if _, err := e.Generator(); err != nil {
+		return nil, err
+	}
+	return e, nil
 }
 
 func (e Entry) Serial(w io.Writer) error {
-	return WriteMultiple(w, BYTE_ORDER, e.Added, e.Period, e.Digits, uint64(e.Hash), e.Name, e.Secret, e.Note)
+	return WriteMultiple(w, BYTE_ORDER, e.Added, e.Period, e.Digits, uint64(e.Hash), e.Name, e.Secret, e.Note,
+		e.Counter, e.Pin, e.Issuer, e.Type, e.Suite, e.Folder, e.Tags, e.Id, e.Modified)
 }
 
-func (e *Entry) Deserial(r io.Reader) error {
+// Deserial reads an entry written by Serial in the given database version
+func (e *Entry) Deserial(r io.Reader, version uint32) error {
 	var tmp uint64
 	err := ReadMultiple(r, BYTE_ORDER, &e.Added, &e.Period, &e.Digits, &tmp, &e.Name, &e.Secret, &e.Note)
 	e.Hash = crypto.Hash(tmp) // Read cant handle crypto.Hash=uint, but uint64 works fine
+	if err != nil {
+		return err
+	}
+
+	// version 4 added the counter, version 5 the pin, version 6 the issuer, version 8 the type, version 9 the suite, version 10 folder and tags, version 11 the id and version 14 the modification time
+	if version >= 4 {
+		err = ReadMultiple(r, BYTE_ORDER, &e.Counter)
+	}
+	if err == nil && version >= 5 {
+		err = ReadMultiple(r, BYTE_ORDER, &e.Pin)
+	}
+	if err == nil && version >= 6 {
+		err = ReadMultiple(r, BYTE_ORDER, &e.Issuer)
+	}
+	if err == nil && version >= 8 {
+		err = ReadMultiple(r, BYTE_ORDER, &e.Type)
+	}
+	if err == nil && version >= 9 {
+		err = ReadMultiple(r, BYTE_ORDER, &e.Suite)
+	}
+	if err == nil && version >= 10 {
+		err = ReadMultiple(r, BYTE_ORDER, &e.Folder, &e.Tags)
+	}
+	if err == nil && version >= 11 {
+		err = ReadMultiple(r, BYTE_ORDER, &e.Id)
+	}
+	if err == nil && version >= 14 {
+		err = ReadMultiple(r, BYTE_ORDER, &e.Modified)
+	} else {
+		e.Modified = e.Added
+	}
 	return err
 }
 
+// touch marks the entry as modified now
+func (e *Entry) touch() {
+	e.Modified = time.Now().UnixMicro()
+}
+
+// newEntryId creates a random entry id
+func newEntryId() string {
+	return hex.EncodeToString(secureRandom(ENTRY_ID_SIZE))
+}
+
+// HasTag checks if the entry has a tag, ignoring case
+func (e Entry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTag adds a tag unless the entry already has it
+func (e *Entry) AddTag(tag string) error {
+	if tag == "" || strings.ContainsAny(tag, " \t,") {
+		return fmt.Errorf("Invalid tag '%s'", tag)
+	}
+	if e.HasTag(tag) {
+		return fmt.Errorf("'%s' already has tag '%s'", e.Name, tag)
+	}
+	e.Tags = append(e.Tags, tag)
+	e.touch()
+	return nil
+}
+
+// RemoveTag removes a tag from the entry
+func (e *Entry) RemoveTag(tag string) error {
+	for i, t := range e.Tags {
+		if strings.EqualFold(t, tag) {
+			e.Tags = append(e.Tags[:i:i], e.Tags[i+1:]...)
+			e.touch()
+			return nil
+		}
+	}
+	return fmt.Errorf("'%s' does not have tag '%s'", e.Name, tag)
+}
+
+// InFolder checks if the entry is in the folder or one of its subfolders
+func (e Entry) InFolder(folder string) bool {
+	folder = strings.ToLower(cleanFolder(folder))
+	current := strings.ToLower(e.Folder)
+	return folder == "" || current == folder || strings.HasPrefix(current, folder+"/")
+}
+
+// cleanFolder removes empty parts and surrounding slashes from a folder path
+func cleanFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(folder, "/") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
 func (e Entry) Date() string {
 	t := time.UnixMicro(e.Added)
 	return t.Format("2006-01-02 15:04:05")
 }
 
-// Totp creates a TOTP object from this entry, to be queried for a code
-func (e Entry) Totp() (*Totp, error) {
-	secret, err := secretFromBase64(e.Secret)
+// Generator creates the code generator for this entry, to be queried for a code
+func (e Entry) Generator() (Generator, error) {
+	t, err := generatorType(e.Type)
 	if err != nil {
 		return nil, err
 	}
+	return t.New(e)
+}
+
+// Editable is true if the algorithm, period and digits of the entry can be changed
+func (e Entry) Editable() bool {
+	t, err := generatorType(e.Type)
+	return err == nil && t.Editable
+}
+
+// PinInCode is true if the PIN is part of the code generation, instead of preceding the code in logins
+func (e Entry) PinInCode() bool {
+	t, err := generatorType(e.Type)
+	return err == nil && t.PinInCode
+}
+
+// Ocra returns the OCRA suite and key of this entry
+func (e Entry) Ocra() (*OcraSuite, []byte, error) {
+	if e.Type != ENTRY_OCRA {
+		return nil, nil, fmt.Errorf("'%s' is not an OCRA entry", e.Name)
+	}
+	suite, err := ParseOcraSuite(e.Suite)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := secretFromBase64(e.Secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	return suite, key, nil
+}
+
+// Verify checks a code at time t and updates the counter (but doesn't save it).
+// Returns the drift in periods, or an error if the code is invalid or was already used
+func (e *Entry) Verify(code string, t time.Time, window int) (int, error) {
+	g, err := e.Generator()
+	if err != nil {
+		return 0, err
+	}
 
-	return NewTotp(secret, int(e.Period), int(e.Digits), e.Hash.New), nil
+	counter, drift, ok := VerifyCode(g, code, t, window)
+	if !ok {
+		return 0, fmt.Errorf("invalid code")
+	}
+	if g.CounterBased() {
+		e.Counter = counter + 1
+		return drift, nil
+	}
+	if counter <= e.Counter {
+		return 0, fmt.Errorf("code has already been used")
+	}
+	e.Counter = counter
+	return drift, nil
 }
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"crypto"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewValid(t *testing.T) {
@@ -64,3 +67,53 @@ func TestNewUri(t *testing.T) {
 	}
 
 }
+
+func TestEntryVerify(t *testing.T) {
+	e := ensure(NewEntry("ok", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "sha1", "", 30, 8))
+
+	// the code for counter 1 from RFC 6238
+	if _, err := e.Verify("94287082", time.Unix(59, 0), 1); err != nil {
+		t.Fatalf("Valid code was rejected: %v", err)
+	}
+	if e.Counter != 1 {
+		t.Errorf("Counter was not updated: %d", e.Counter)
+	}
+
+	// using the same code again, even later, should fail
+	if _, err := e.Verify("94287082", time.Unix(61, 0), 1); err == nil {
+		t.Errorf("Replayed code was accepted")
+	}
+	if _, err := e.Verify("00000000", time.Unix(61, 0), 1); err == nil {
+		t.Errorf("Invalid code was accepted")
+	}
+}
+
+func FuzzEntryDeserial(f *testing.F) {
+	e := ensure(NewEntry("ok", "NZSXMZLSEBTW63TOME", "sha1", "note", 30, 6))
+	e.Folder, e.Tags, e.Id = "work", []string{"prod"}, newEntryId()
+	buf := new(bytes.Buffer)
+	e.Serial(buf)
+	f.Add(buf.Bytes(), DATABASE_VERSION)
+	f.Add(buf.Bytes(), uint32(3))
+	f.Add([]byte{}, DATABASE_VERSION)
+
+	f.Fuzz(func(t *testing.T, data []byte, version uint32) {
+		var e1 Entry
+		if err := e1.Deserial(bytes.NewReader(data), version); err != nil || version < DATABASE_VERSION {
+			return
+		}
+
+		// an entry that could be read is written and read back the same
+		out := new(bytes.Buffer)
+		if err := e1.Serial(out); err != nil {
+			t.Fatalf("Unable to write entry: %v", err)
+		}
+		var e2 Entry
+		if err := e2.Deserial(out, DATABASE_VERSION); err != nil {
+			t.Fatalf("Unable to read written entry: %v", err)
+		}
+		if !reflect.DeepEqual(e1, e2) {
+			t.Errorf("Entry changed: %v vs %v", e1, e2)
+		}
+	})
+}
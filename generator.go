@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto"
+	"crypto/subtle"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Generator creates the codes of an entry. The algorithms only differ in how
+// the code for a counter is created, generating and verifying codes at a
+// given time is shared, see GenerateCode and VerifyCode
+type Generator interface {
+	// Counter returns the time step at a time, or the next counter for counter-based generators
+	Counter(at time.Time) int64
+	// Code returns the code for a counter
+	Code(counter int64) string
+	// Validity returns the time span where the code for a time step is valid,
+	// counter-based codes are valid until they are used
+	Validity(counter int64) (time.Time, time.Time)
+	// CounterBased is true if the counter is increased for every code instead of following the time
+	CounterBased() bool
+	// Hints tells the presentation how to show the codes
+	Hints() DisplayHints
+}
+
+// DisplayHints describes how codes are shown
+type DisplayHints struct {
+	Group int // show the code in groups of this many characters, 0 to show it as is
+}
+
+// GeneratorType describes one type of entry
+type GeneratorType struct {
+	// Name is shown to the user
+	Name string
+	// New creates the generator for an entry
+	New func(e Entry) (Generator, error)
+	// Option is the name used with 'add -type', empty if entries of this type are added some other way
+	Option string
+	// Period, Digits and Hash replace the options when an entry is added, zero to use the
+	// options. They are also the defaults for parameters missing from an otpauth URI
+	Period int
+	Digits int
+	Hash   crypto.Hash
+	// Editable is true if the algorithm, period and digits can be changed after the entry is added
+	Editable bool
+	// UriType and UriEncoder are used in otpauth URIs, UriType is empty if the entry can't be exported
+	UriType    string
+	UriEncoder string
+	// UriCounter is true if the URI has the counter of the entry instead of the period
+	UriCounter bool
+	// PinInCode is true if the PIN is used to create the code, instead of preceding the code in logins
+	PinInCode bool
+}
+
+// generatorTypes contains the registered entry types, keyed by Entry.Type
+var generatorTypes = map[string]GeneratorType{}
+
+// RegisterGenerator adds an entry type, this is done by each algorithm when the program starts
+func RegisterGenerator(entryType string, t GeneratorType) {
+	if _, found := generatorTypes[entryType]; found {
+		panic("Entry type registered twice: " + entryType)
+	}
+	generatorTypes[entryType] = t
+}
+
+// generatorType returns the registered entry type
+func generatorType(entryType string) (GeneratorType, error) {
+	t, found := generatorTypes[entryType]
+	if !found {
+		return t, fmt.Errorf("Unknown entry type '%s'", entryType)
+	}
+	return t, nil
+}
+
+// generatorTypeByOption returns the entry type for a name used with -type
+func generatorTypeByOption(option string) (string, error) {
+	var options []string
+	for entryType, t := range generatorTypes {
+		if t.Option != "" && strings.EqualFold(t.Option, option) {
+			return entryType, nil
+		}
+		if t.Option != "" {
+			options = append(options, t.Option)
+		}
+	}
+	sort.Strings(options)
+	return "", fmt.Errorf("Unknown entry type '%s', use %s", option, strings.Join(options, ", "))
+}
+
+// GenerateCode returns the code at a time and the seconds until it expires,
+// or zero for counter-based generators
+func GenerateCode(g Generator, at time.Time) (int, string) {
+	counter := g.Counter(at)
+	if g.CounterBased() {
+		return 0, g.Code(counter)
+	}
+	_, until := g.Validity(counter)
+	return int(until.Unix() - at.Unix()), g.Code(counter)
+}
+
+// VerifyCode checks a code at a time, allowing the clock to be off by up to window time steps.
+// Counter-based generators look ahead up to window counters instead.
+// All codes in the window are compared in constant time. On success the counter of the
+// matching code is returned together with the drift from the expected counter
+func VerifyCode(g Generator, code string, at time.Time, window int) (int64, int, bool) {
+	expected := g.Counter(at)
+	first := -window
+	if g.CounterBased() {
+		first = 0
+	}
+
+	found, drift := 0, 0
+	for d := first; d <= window; d++ {
+		match := subtle.ConstantTimeCompare([]byte(code), []byte(g.Code(expected+int64(d))))
+		drift = subtle.ConstantTimeSelect(match&(found^1), d, drift)
+		found |= match
+	}
+	return expected + int64(drift), drift, found == 1
+}
+
+// stepValidity is the validity of a time step for generators with a fixed period in seconds
+func stepValidity(counter, period int64) (time.Time, time.Time) {
+	from := time.Unix(counter*period, 0)
+	return from, from.Add(time.Duration(period) * time.Second)
+}
+
+// groupHint groups codes longer than 4 characters in two halves
+func groupHint(digits int) DisplayHints {
+	if digits <= 4 {
+		return DisplayHints{}
+	}
+	return DisplayHints{Group: (digits + 1) / 2}
+}
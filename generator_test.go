@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeneratorTypes(t *testing.T) {
+	for _, name := range []string{ENTRY_TOTP, ENTRY_HOTP, ENTRY_STEAM, ENTRY_OCRA, ENTRY_MOTP, ENTRY_YANDEX} {
+		if _, err := generatorType(name); err != nil {
+			t.Errorf("Entry type '%s' is not registered", name)
+		}
+	}
+
+	// the names used with -type
+	for option, want := range map[string]string{"totp": ENTRY_TOTP, "HOTP": ENTRY_HOTP, "steam": ENTRY_STEAM, "motp": ENTRY_MOTP, "yandex": ENTRY_YANDEX} {
+		if got, err := generatorTypeByOption(option); err != nil || got != want {
+			t.Errorf("Option '%s' is type '%s' (%v)", option, got, err)
+		}
+	}
+	if _, err := generatorTypeByOption("ocra"); err == nil {
+		t.Errorf("OCRA entries are added with a suite")
+	}
+
+	// the parameters of the type replace the options
+	steam := ensure(NewTypedEntry(ENTRY_STEAM, "steam", "GEZDGNBVGY3TQOJQ", "sha256", "", "", 60, 8))
+	if steam.Digits != STEAM_DIGITS || steam.Period != DEFAULT_PERIOD || steam.Hash != crypto.SHA1 || steam.Editable() {
+		t.Errorf("Wrong Steam entry: %+v", steam)
+	}
+	if _, err := NewTypedEntry(ENTRY_HOTP, "hotp", "not base32!", "sha1", "", "", 30, 6); err == nil {
+		t.Errorf("Invalid secret was accepted")
+	}
+
+	e := &Entry{Name: "unknown", Type: "unknown"}
+	if _, err := e.Generator(); err == nil {
+		t.Errorf("Unknown type should fail")
+	}
+	if _, err := EntryToUri(e); err == nil {
+		t.Errorf("Unknown type should not be exported")
+	}
+}
+
+func TestHotpEntry(t *testing.T) {
+	// test vectors from RFC 4226 appendix D
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	entry := ensure(EntryFromUri("otpauth://hotp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=0"))
+	if entry.Type != ENTRY_HOTP {
+		t.Fatalf("Expected a HOTP entry, got '%s'", entry.Type)
+	}
+
+	for i, code := range expected {
+		g := ensure(entry.Generator())
+		if !g.CounterBased() {
+			t.Fatalf("HOTP should be counter-based")
+		}
+		if timeleft, got := GenerateCode(g, time.Now()); got != code || timeleft != 0 {
+			t.Errorf("HOTP(%d): expected %s got %s", i, code, got)
+		}
+		entry.Counter++
+	}
+
+	// verification looks ahead but never back
+	entry.Counter = 3
+	if _, err := entry.Verify("287082", time.Now(), 5); err == nil {
+		t.Errorf("Old HOTP code was accepted")
+	}
+	if drift, err := entry.Verify("254676", time.Now(), 5); err != nil || drift != 2 {
+		t.Errorf("Expected drift 2, got %d (%v)", drift, err)
+	}
+	if entry.Counter != 6 {
+		t.Errorf("Expected counter 6 got %d", entry.Counter)
+	}
+	if _, err := entry.Verify("254676", time.Now(), 5); err == nil {
+		t.Errorf("HOTP code was accepted twice")
+	}
+
+	uri := ensure(EntryToUri(entry))
+	if !strings.HasPrefix(uri, "otpauth://hotp/") || !strings.Contains(uri, "counter=6") {
+		t.Errorf("Unexpected URI %s", uri)
+	}
+}
+
+func TestGroupCode(t *testing.T) {
+	tests := []struct {
+		code     string
+		hints    DisplayHints
+		expected string
+	}{
+		{"123456", groupHint(6), "123 456"},
+		{"12345678", groupHint(8), "1234 5678"},
+		{"1234567", groupHint(7), "1234 567"},
+		{"1234", groupHint(4), "1234"},
+		{"PY4YB", DisplayHints{}, "PY4YB"},
+	}
+	for _, test := range tests {
+		if got := groupCode(test.code, test.hints); got != test.expected {
+			t.Errorf("Expected '%s' got '%s'", test.expected, got)
+		}
+	}
+}
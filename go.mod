@@ -1,3 +1,3 @@
 module github.com/avahidi/tok
 
-go 1.19
+go 1.20
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+)
+
+// Hotp is a counter-based generator (RFC 4226), it uses the same codes as TOTP
+// but the counter is increased for every code instead of following the time
+type Hotp struct {
+	totp *Totp
+	next int64
+}
+
+func init() {
+	RegisterGenerator(ENTRY_HOTP, GeneratorType{
+		Name: "HOTP",
+		New: func(e Entry) (Generator, error) {
+			secret, err := secretFromBase64(e.Secret)
+			if err != nil {
+				return nil, err
+			}
+			totp := NewTotp(secret, int(e.Period), int(e.Digits), e.Hash.New)
+			return &Hotp{totp: totp, next: e.Counter}, nil
+		},
+		Option:     "hotp",
+		Editable:   true,
+		UriType:    "hotp",
+		UriCounter: true,
+	})
+}
+
+// Counter returns the next counter, the time is not used
+func (h Hotp) Counter(at time.Time) int64 {
+	return h.next
+}
+
+// Code returns the code for a counter
+func (h Hotp) Code(counter int64) string {
+	return h.totp.Code(counter)
+}
+
+// Validity is not limited for HOTP codes, they are valid until used
+func (h Hotp) Validity(counter int64) (time.Time, time.Time) {
+	return time.Time{}, time.Time{}
+}
+
+func (h Hotp) CounterBased() bool {
+	return true
+}
+
+func (h Hotp) Hints() DisplayHints {
+	return h.totp.Hints()
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DuplicateMode decides what happens when an imported entry already exists
+type DuplicateMode int
+
+const (
+	DUPLICATE_SKIP DuplicateMode = iota
+	DUPLICATE_RENAME
+	DUPLICATE_REPLACE
+)
+
+// duplicateModeFromName converts the command-line name to a DuplicateMode
+func duplicateModeFromName(name string) (DuplicateMode, error) {
+	switch strings.ToLower(name) {
+	case "skip":
+		return DUPLICATE_SKIP, nil
+	case "rename":
+		return DUPLICATE_RENAME, nil
+	case "replace":
+		return DUPLICATE_REPLACE, nil
+	default:
+		return 0, fmt.Errorf("unknown duplicate mode: '%s'", name)
+	}
+}
+
+// ImportResult describes what happened to one line of an import
+type ImportResult struct {
+	Line   int
+	Name   string
+	Status string
+	Err    error
+}
+
+// Import reads otpauth URIs, one per line, and adds them to the database (but doesn't save it).
+// The import is transactional: if any line fails nothing is added and an error is returned.
+// Empty lines and lines starting with '#' are ignored.
+func (db *Database) Import(r io.Reader, mode DuplicateMode) ([]ImportResult, error) {
+	// work on a copy, so we can back out if something goes wrong
+	tmp := &Database{
+		Entries:      append([]*Entry{}, db.Entries...),
+		Journal:      append([]*JournalRecord{}, db.Journal...),
+		JournalStart: db.JournalStart,
+	}
+
+	var results []ImportResult
+	failed := 0
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		str := strings.TrimSpace(scanner.Text())
+		if str == "" || str[0] == '#' {
+			continue
+		}
+
+		result := ImportResult{Line: line}
+		entry, err := EntryFromUri(str)
+		if err == nil {
+			result.Name = entry.Name
+			result.Status, err = tmp.importEntry(entry, mode)
+		}
+		if err != nil {
+			result.Status = "failed"
+			result.Err = err
+			failed++
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return results, err
+	}
+
+	if failed != 0 {
+		return results, fmt.Errorf("%d of %d entries could not be imported, nothing was added", failed, len(results))
+	}
+	db.Entries = tmp.Entries
+	db.Journal = tmp.Journal
+	db.JournalStart = tmp.JournalStart
+	return results, nil
+}
+
+// Merge adds already parsed entries to the database (but doesn't save it)
+func (db *Database) Merge(entries []*Entry, mode DuplicateMode) []ImportResult {
+	var results []ImportResult
+	for i, entry := range entries {
+		result := ImportResult{Line: i + 1, Name: entry.Name}
+		result.Status, result.Err = db.importEntry(entry, mode)
+		results = append(results, result)
+	}
+	return results
+}
+
+// importEntry adds one entry while handling duplicates, returns a short status text
+func (db *Database) importEntry(entry *Entry, mode DuplicateMode) (string, error) {
+	byName := db.findExact(entry.Name)
+	bySecret := db.findSecret(entry.Secret)
+	if byName == nil && bySecret == nil {
+		return "added", db.Add(entry)
+	}
+
+	switch mode {
+	case DUPLICATE_RENAME:
+		if bySecret != nil {
+			return fmt.Sprintf("skipped, same secret as '%s'", bySecret.Name), nil
+		}
+		name := entry.Name
+		for i := 2; db.findExact(entry.Name) != nil; i++ {
+			entry.Name = fmt.Sprintf("%s (%d)", name, i)
+		}
+		return fmt.Sprintf("added as '%s'", entry.Name), db.Add(entry)
+
+	case DUPLICATE_REPLACE:
+		// the name and the secret may belong to two different entries, replace both
+		var entries []*Entry
+		replaced := false
+		for _, e := range db.Entries {
+			if e != byName && e != bySecret {
+				entries = append(entries, e)
+			} else if !replaced {
+				entry.Id = e.Id // keep the id of the replaced entry
+				entries = append(entries, entry)
+				db.Record(JOURNAL_REPLACE, entry)
+				replaced = true
+			}
+		}
+		db.Entries = entries
+		return "replaced", nil
+
+	default:
+		if byName != nil {
+			return "skipped, name already exists", nil
+		}
+		return fmt.Sprintf("skipped, same secret as '%s'", bySecret.Name), nil
+	}
+}
+
+// findSecret will search for a token with the same secret
+func (db Database) findSecret(secret string) *Entry {
+	key, err := secretFromBase64(secret)
+	if err != nil {
+		return nil
+	}
+	for _, e := range db.Entries {
+		if key2, err := secretFromBase64(e.Secret); err == nil && bytes.Equal(key, key2) {
+			return e
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const IMPORT_INPUT = `# comments and empty lines are ignored
+
+otpauth://totp/one?secret=NZSXMZLSEBTW63TOME&algorithm=SHA1&digits=6&period=30
+otpauth://totp/two?secret=M5UXMZJAPFXXKIDVOA&algorithm=SHA1&digits=6&period=30
+otpauth://totp/three?secret=NZSXMZLSEBTW63TOME&algorithm=SHA1&digits=6&period=30
+`
+
+func TestImport(t *testing.T) {
+	db := &Database{}
+	results, err := db.Import(strings.NewReader(IMPORT_INPUT), DUPLICATE_SKIP)
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %v", results)
+	}
+	if results[0].Line != 3 || results[0].Status != "added" {
+		t.Errorf("Unexpected first result: %v", results[0])
+	}
+
+	// "three" has the same secret as "one"
+	if len(db.Entries) != 2 || db.Entries[0].Name != "one" || db.Entries[1].Name != "two" {
+		t.Errorf("Import added wrong entries: %v", db.Entries)
+	}
+}
+
+func TestImportDuplicates(t *testing.T) {
+	tests := []struct {
+		mode  DuplicateMode
+		names []string
+	}{
+		{DUPLICATE_SKIP, []string{"one", "two"}},
+		{DUPLICATE_RENAME, []string{"one", "two", "one (2)"}},
+		{DUPLICATE_REPLACE, []string{"one", "TWO"}},
+	}
+
+	const INPUT = "otpauth://totp/one?secret=GEZDGNBVGY3TQOJQ&algorithm=SHA1&digits=6&period=30\n" +
+		"otpauth://totp/TWO?secret=M5UXMZJAPFXXKIDVOA&algorithm=SHA1&digits=8&period=30\n"
+
+	for _, test := range tests {
+		db := &Database{}
+		add(db, "one", "NZSXMZLSEBTW63TOME")
+		add(db, "two", "M5UXMZJAPFXXKIDVOA")
+
+		if _, err := db.Import(strings.NewReader(INPUT), test.mode); err != nil {
+			t.Fatalf("Import failed: %v", err)
+		}
+
+		if len(db.Entries) != len(test.names) {
+			t.Fatalf("Mode %d: expected %v got %v", test.mode, test.names, db.Entries)
+		}
+		for i, name := range test.names {
+			if db.Entries[i].Name != name {
+				t.Errorf("Mode %d: expected %s got %s", test.mode, name, db.Entries[i].Name)
+			}
+		}
+	}
+
+	// replace should have updated both the name and the secret match
+	db := &Database{}
+	add(db, "one", "NZSXMZLSEBTW63TOME")
+	add(db, "two", "M5UXMZJAPFXXKIDVOA")
+	db.Import(strings.NewReader(INPUT), DUPLICATE_REPLACE)
+	if db.Entries[0].Secret != "GEZDGNBVGY3TQOJQ" || db.Entries[1].Digits != 8 {
+		t.Errorf("Replace did not replace entries: %v %v", db.Entries[0], db.Entries[1])
+	}
+}
+
+func TestImportTransaction(t *testing.T) {
+	const INPUT = "otpauth://totp/new?secret=GEZDGNBVGY3TQOJQ&algorithm=SHA1&digits=6&period=30\n" +
+		"this is not an URI\n"
+
+	db := &Database{}
+	add(db, "one", "NZSXMZLSEBTW63TOME")
+
+	results, err := db.Import(strings.NewReader(INPUT), DUPLICATE_SKIP)
+	if err == nil {
+		t.Fatalf("Import should have failed")
+	}
+	if len(results) != 2 || results[1].Err == nil {
+		t.Errorf("Expected the second line to fail: %v", results)
+	}
+	if len(db.Entries) != 1 {
+		t.Errorf("Failed import should not change the database: %v", db.Entries)
+	}
+}
+
+func TestImportJournal(t *testing.T) {
+	db := &Database{}
+	add(db, "one", "NZSXMZLSEBTW63TOME")
+	add(db, "two", "M5UXMZJAPFXXKIDVOA")
+	if _, err := db.Import(strings.NewReader(IMPORT_INPUT), DUPLICATE_REPLACE); err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	ops := []string{JOURNAL_ADD, JOURNAL_ADD, JOURNAL_REPLACE, JOURNAL_REPLACE, JOURNAL_REPLACE}
+	if len(db.Journal) != len(ops) {
+		t.Fatalf("Wrong number of records: %v", db.Journal)
+	}
+	for i, op := range ops {
+		if db.Journal[i].Op != op {
+			t.Errorf("Record %d is '%s', wanted '%s'", i+1, db.Journal[i].Op, op)
+		}
+	}
+	if err := VerifyJournal(db.JournalStart, db.Journal); err != nil {
+		t.Errorf("Journal did not verify: %v", err)
+	}
+
+	// a failed import records nothing
+	db.Import(strings.NewReader("otpauth://totp/new?secret=GEZDGNBVGY3TQOJQ\nnot an URI\n"), DUPLICATE_SKIP)
+	if len(db.Journal) != len(ops) {
+		t.Errorf("Failed import was recorded: %v", db.Journal)
+	}
+}
+
+func TestImportLimit(t *testing.T) {
+	db := &Database{}
+	for i := 0; i < DATABASE_MAX_ENTRIES-1; i++ {
+		db.Entries = append(db.Entries, &Entry{Name: fmt.Sprintf("entry %d", i)})
+	}
+
+	if _, err := db.Import(strings.NewReader(IMPORT_INPUT), DUPLICATE_SKIP); err == nil {
+		t.Errorf("Import past the limit should fail")
+	}
+	if len(db.Entries) != DATABASE_MAX_ENTRIES-1 {
+		t.Errorf("Failed import changed the database: %d entries", len(db.Entries))
+	}
+	if _, err := db.Import(strings.NewReader("otpauth://totp/one?secret=NZSXMZLSEBTW63TOME\n"), DUPLICATE_SKIP); err != nil {
+		t.Errorf("Import up to the limit failed: %v", err)
+	}
+
+	// the same for merging
+	other := &Database{}
+	add(other, "two", "M5UXMZJAPFXXKIDVOA")
+	if err := db.ApplySync(other, db.PlanSync(other)); err == nil || len(db.Entries) != DATABASE_MAX_ENTRIES {
+		t.Errorf("Merge past the limit should fail: %v", err)
+	}
+}
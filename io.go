@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -10,17 +11,29 @@ var (
 	BYTE_ORDER = binary.BigEndian
 )
 
-// ReadExact is a helper function for reading an exact amount of bytes
+// sanity checks when reading, so that a corrupted size doesn't allocate gigabytes
+const (
+	MAX_STRINGS     = 1000    // number of strings in a string list
+	MAX_STRING_SIZE = 1 << 20 // strings and byte slices read by ReadOne
+	MAX_SIZED_SIZE  = 1 << 26 // data read by ReadSized, e.g. the encrypted database
+)
+
+// ReadExact is a helper function for reading an exact amount of bytes. The reader
+// may return less than asked for in each read, and the buffer grows as data
+// arrives instead of trusting the size
 func ReadExact(r io.Reader, size int) ([]byte, error) {
-	buffer := make([]byte, size)
-	n, err := r.Read(buffer)
-	if err != nil {
-		return nil, err
+	if size < 0 {
+		return nil, fmt.Errorf("Invalid size %d", size)
 	}
-	if n != size {
+	buffer := new(bytes.Buffer)
+	n, err := io.CopyN(buffer, r, int64(size))
+	if err == io.EOF && n != 0 {
 		return nil, fmt.Errorf("Expected to read %d bytes, got %d", size, n)
 	}
-	return buffer, nil
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
 }
 
 // WriteExact is a helper function for writing an exact amount of bytes
@@ -37,10 +50,18 @@ func WriteExact(w io.Writer, data []byte) error {
 
 // ReadSized is a  helper function for reading data in form of <uint32 size><size bytes>
 func ReadSized(r io.Reader, order binary.ByteOrder) ([]byte, error) {
+	return ReadSizedMax(r, order, MAX_SIZED_SIZE)
+}
+
+// ReadSizedMax is ReadSized with a maximum size
+func ReadSizedMax(r io.Reader, order binary.ByteOrder, max uint32) ([]byte, error) {
 	var size uint32
 	if err := binary.Read(r, order, &size); err != nil {
 		return nil, err
 	}
+	if size > max {
+		return nil, fmt.Errorf("Size %d is larger than %d", size, max)
+	}
 
 	return ReadExact(r, int(size))
 }
@@ -53,16 +74,40 @@ func WriteSized(w io.Writer, order binary.ByteOrder, data []byte) error {
 	return WriteExact(w, data)
 }
 
-// ReadOne is a binary Read function that also supports strings
+// ReadOne is a binary Read function that also supports strings, byte slices and string lists
 func ReadOne(r io.Reader, order binary.ByteOrder, obj any) error {
 	switch x := obj.(type) {
 	case *string:
-		data, err := ReadSized(r, order)
+		data, err := ReadSizedMax(r, order, MAX_STRING_SIZE)
 		if err != nil {
 			return err
 		}
 		*x = string(data)
 
+		return nil
+	case *[]byte:
+		data, err := ReadSizedMax(r, order, MAX_STRING_SIZE)
+		if err != nil {
+			return err
+		}
+		*x = data
+		return nil
+	case *[]string:
+		var count uint32
+		if err := binary.Read(r, order, &count); err != nil {
+			return err
+		}
+		if count > MAX_STRINGS {
+			return fmt.Errorf("Too many strings: %d", count)
+		}
+		*x = nil
+		for i := 0; i < int(count); i++ {
+			var str string
+			if err := ReadOne(r, order, &str); err != nil {
+				return err
+			}
+			*x = append(*x, str)
+		}
 		return nil
 	default:
 		return binary.Read(r, order, obj)
@@ -92,6 +137,16 @@ func WriteOne(w io.Writer, order binary.ByteOrder, obj any) error {
 		}
 		_, err := w.Write(x)
 		return err
+	case []string:
+		if err := binary.Write(w, order, uint32(len(x))); err != nil {
+			return err
+		}
+		for _, str := range x {
+			if err := WriteOne(w, order, str); err != nil {
+				return err
+			}
+		}
+		return nil
 	default:
 		return binary.Write(w, order, obj)
 	}
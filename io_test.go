@@ -3,7 +3,9 @@ package main
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 	"testing"
+	"testing/iotest"
 )
 
 func TestSingle(t *testing.T) {
@@ -52,3 +54,90 @@ func TestMultiple(t *testing.T) {
 		}
 	}
 }
+
+func TestStrings(t *testing.T) {
+	buf := new(bytes.Buffer)
+	input := []string{"prod", "", "work stuff"}
+	if err := WriteMultiple(buf, BYTE_ORDER, input, []string{}); err != nil {
+		t.Fatalf("Failed to save strings: %v", err)
+	}
+
+	var got, empty []string
+	if err := ReadMultiple(buf, BYTE_ORDER, &got, &empty); err != nil {
+		t.Fatalf("Failed to load strings: %v", err)
+	}
+	if len(got) != len(input) || got[0] != input[0] || got[1] != input[1] || got[2] != input[2] || len(empty) != 0 {
+		t.Errorf("Incorrect string list serialization: wanted %q got %q %q", input, got, empty)
+	}
+}
+
+func TestShortReads(t *testing.T) {
+	buf := new(bytes.Buffer)
+	const INPUT = "this string arrives one byte at a time"
+	if err := WriteMultiple(buf, BYTE_ORDER, INPUT, []string{"a", "b"}, uint64(42)); err != nil {
+		t.Fatalf("Failed to save multiple: %v", err)
+	}
+
+	for _, r := range []io.Reader{iotest.OneByteReader(bytes.NewReader(buf.Bytes())), iotest.HalfReader(bytes.NewReader(buf.Bytes()))} {
+		var str string
+		var list []string
+		var num uint64
+		if err := ReadMultiple(r, BYTE_ORDER, &str, &list, &num); err != nil {
+			t.Fatalf("Failed to load from short reads: %v", err)
+		}
+		if str != INPUT || len(list) != 2 || num != 42 {
+			t.Errorf("Incorrect values from short reads: '%s' %q %d", str, list, num)
+		}
+	}
+
+	// a truncated string is an error, not a short string
+	var str string
+	if err := ReadOne(bytes.NewReader(buf.Bytes()[:10]), BYTE_ORDER, &str); err == nil {
+		t.Errorf("Truncated string was accepted: '%s'", str)
+	}
+}
+
+func TestSizeLimits(t *testing.T) {
+	huge := new(bytes.Buffer)
+	binary.Write(huge, BYTE_ORDER, uint32(0xffffffff))
+	huge.WriteString("short")
+
+	var str string
+	if err := ReadOne(bytes.NewReader(huge.Bytes()), BYTE_ORDER, &str); err == nil {
+		t.Errorf("Huge string was accepted")
+	}
+	if _, err := ReadSized(bytes.NewReader(huge.Bytes()), BYTE_ORDER); err == nil {
+		t.Errorf("Huge data was accepted")
+	}
+	if _, err := ReadExact(bytes.NewReader(huge.Bytes()), 0x7fffffff); err == nil {
+		t.Errorf("Truncated data was accepted")
+	}
+}
+
+func FuzzReadMultiple(f *testing.F) {
+	buf := new(bytes.Buffer)
+	WriteMultiple(buf, BYTE_ORDER, "string", uint32(111), []byte{1, 2, 3}, []string{"a", "b"}, int64(-1))
+	f.Add(buf.Bytes())
+	f.Add([]byte{})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var str string
+		var num uint32
+		var raw []byte
+		var list []string
+		var signed int64
+		if err := ReadMultiple(bytes.NewReader(data), BYTE_ORDER, &str, &num, &raw, &list, &signed); err != nil {
+			return
+		}
+
+		// whatever was read is written back the same way
+		out := new(bytes.Buffer)
+		if err := WriteMultiple(out, BYTE_ORDER, str, num, raw, list, signed); err != nil {
+			t.Fatalf("Failed to save multiple: %v", err)
+		}
+		if !bytes.HasPrefix(data, out.Bytes()) {
+			t.Errorf("Written data differs from the input: %x vs %x", out.Bytes(), data)
+		}
+	})
+}
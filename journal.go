@@ -0,0 +1,147 @@
+// Change journal
+//
+// Changes to the entries are recorded in the encrypted payload together with
+// the time, host and user. Each record contains a SHA-256 hash over the previous
+// hash and its own fields, so a record that is changed or removed breaks the
+// chain. Note that someone with the database key can still rewrite the whole chain.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"time"
+)
+
+const (
+	JOURNAL_ADD     = "add"
+	JOURNAL_EDIT    = "edit"
+	JOURNAL_EXPORT  = "export"
+	JOURNAL_SHARE   = "share"
+	JOURNAL_MOVE    = "move"
+	JOURNAL_REPLACE = "replace"
+	JOURNAL_REMOVE  = "remove"
+	JOURNAL_RESTORE = "restore"
+	JOURNAL_PURGE   = "purge"
+	JOURNAL_MERGE   = "merge"
+
+	JOURNAL_MAX_RECORDS = 100000
+)
+
+// JournalRecord is one change to an entry
+type JournalRecord struct {
+	Time    int64 // microseconds like Entry.Added
+	Op      string
+	EntryId string
+	Name    string // the name of the entry at the time
+	Host    string
+	User    string
+	Hash    []byte
+}
+
+func (r JournalRecord) Date() string {
+	return time.UnixMicro(r.Time).Format("2006-01-02 15:04:05")
+}
+
+// chainHash is the hash over the previous hash and the fields of the record
+func (r JournalRecord) chainHash(prev []byte) []byte {
+	h := sha256.New()
+	h.Write(prev)
+	WriteMultiple(h, BYTE_ORDER, r.Time, r.Op, r.EntryId, r.Name, r.Host, r.User)
+	return h.Sum(nil)
+}
+
+// Record adds a change of the entry to the journal. When the journal is full the
+// oldest record is dropped and its hash becomes the start of the chain
+func (db *Database) Record(op string, entry *Entry) {
+	r := &JournalRecord{
+		Time:    time.Now().UnixMicro(),
+		Op:      op,
+		EntryId: entry.Id,
+		Name:    entry.Name,
+		Host:    "unknown",
+		User:    "unknown",
+	}
+	if host, err := os.Hostname(); err == nil {
+		r.Host = host
+	}
+	if u, err := user.Current(); err == nil {
+		r.User = u.Username
+	} else if name := os.Getenv("USER"); name != "" {
+		r.User = name
+	}
+
+	prev := db.JournalStart
+	if n := len(db.Journal); n != 0 {
+		prev = db.Journal[n-1].Hash
+	}
+	r.Hash = r.chainHash(prev)
+	if len(db.Journal) >= JOURNAL_MAX_RECORDS {
+		db.JournalStart = db.Journal[0].Hash
+		db.Journal = db.Journal[1:]
+	}
+	db.Journal = append(db.Journal, r)
+}
+
+// VerifyJournal checks the hash chain from the start hash, the error tells which
+// record is the first bad one
+func VerifyJournal(start []byte, journal []*JournalRecord) error {
+	prev := start
+	for i, r := range journal {
+		if !bytes.Equal(r.Hash, r.chainHash(prev)) {
+			return fmt.Errorf("Record %d (%s '%s' at %s) does not match the chain", i+1, r.Op, r.Name, r.Date())
+		}
+		prev = r.Hash
+	}
+	return nil
+}
+
+// History returns the records for an entry id
+func (db Database) History(id string) []*JournalRecord {
+	var ret []*JournalRecord
+	for _, r := range db.Journal {
+		if r.EntryId == id {
+			ret = append(ret, r)
+		}
+	}
+	return ret
+}
+
+// writeJournal writes the start of the chain and the records
+func writeJournal(w io.Writer, start []byte, journal []*JournalRecord) error {
+	if err := WriteMultiple(w, BYTE_ORDER, start, uint32(len(journal))); err != nil {
+		return err
+	}
+	for _, r := range journal {
+		if err := WriteMultiple(w, BYTE_ORDER, r.Time, r.Op, r.EntryId, r.Name, r.Host, r.User, r.Hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readJournal reads what writeJournal wrote
+func readJournal(r io.Reader) ([]byte, []*JournalRecord, error) {
+	var start []byte
+	var count uint32
+	if err := ReadMultiple(r, BYTE_ORDER, &start, &count); err != nil {
+		return nil, nil, err
+	}
+	if count > JOURNAL_MAX_RECORDS {
+		return nil, nil, fmt.Errorf("Too many journal records: %d", count)
+	}
+
+	var journal []*JournalRecord
+	for i := 0; i < int(count); i++ {
+		rec := &JournalRecord{}
+		if err := ReadMultiple(r, BYTE_ORDER, &rec.Time, &rec.Op, &rec.EntryId, &rec.Name, &rec.Host, &rec.User, &rec.Hash); err != nil {
+			return nil, nil, err
+		}
+		journal = append(journal, rec)
+	}
+	return start, journal, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	db := &Database{}
+	e1 := add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+	e2 := add(db, "entry 2", "M5UXMZJAPFXXKIDVOA")
+	name := "renamed"
+	if err := db.Edit(e1, EntryChanges{Name: &name}); err != nil {
+		t.Fatalf("Edit failed: %v", err)
+	}
+	db.Delete(e2)
+
+	ops := []string{JOURNAL_ADD, JOURNAL_ADD, JOURNAL_EDIT, JOURNAL_REMOVE}
+	if len(db.Journal) != len(ops) {
+		t.Fatalf("Wrong number of records: %d", len(db.Journal))
+	}
+	for i, op := range ops {
+		if db.Journal[i].Op != op {
+			t.Errorf("Record %d is '%s', wanted '%s'", i+1, db.Journal[i].Op, op)
+		}
+	}
+	if h := db.History(e1.Id); len(h) != 2 || h[1].Name != "renamed" || h[1].Host == "" || h[1].User == "" {
+		t.Errorf("Wrong history for entry: %v", h)
+	}
+
+	if err := VerifyJournal(db.JournalStart, db.Journal); err != nil {
+		t.Errorf("Journal did not verify: %v", err)
+	}
+	db.Journal[1].Name = "changed"
+	if err := VerifyJournal(db.JournalStart, db.Journal); err == nil {
+		t.Errorf("Changed record was not detected")
+	}
+	db.Journal[1].Name = "entry 2"
+	if err := VerifyJournal(db.JournalStart, append(db.Journal[:1:1], db.Journal[2:]...)); err == nil {
+		t.Errorf("Removed record was not detected")
+	}
+}
+
+func TestJournalSaveLoad(t *testing.T) {
+	filename := t.TempDir() + "/test.tokdb"
+	db1 := ensure(CreateDatabase(filename, "password"))
+	add(db1, "entry 1", "NZSXMZLSEBTW63TOME")
+	db1.JournalStart = []byte("start")
+	db1.Journal[0].Hash = db1.Journal[0].chainHash(db1.JournalStart)
+	if err := db1.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	db2 := ensure(LoadDatabase(filename, "password"))
+	if len(db2.Journal) != 1 || !reflect.DeepEqual(db2.Journal[0], db1.Journal[0]) {
+		t.Fatalf("Loaded journal differs: %v", db2.Journal)
+	}
+	if err := VerifyJournal(db2.JournalStart, db2.Journal); err != nil {
+		t.Errorf("Loaded journal did not verify: %v", err)
+	}
+}
@@ -0,0 +1,324 @@
+// Key slots allow several members to open the same database.
+//
+// The database content is encrypted with a random content key. Each slot has
+// an X25519 public key and a copy of the content key encrypted for it. Password
+// slots also store the matching private key, encrypted with a key derived from
+// the password. Members using a public key keep the private key in their own
+// database (see keygen). Since only public keys are needed to wrap the content
+// key, it can be rotated without knowing the passwords of the other members.
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"fmt"
+	"io"
+)
+
+const (
+	CONTENT_KEY_SIZE = 32
+	KEYSLOT_INFO     = "tok key slot"
+	RECOVERY_MEMBER  = "recovery"        // the recovery key made with the database
+	RECOVERY_SHARES  = "recovery shares" // the key split with 'recovery split'
+)
+
+// KeySlot is one way to unlock the database content key
+type KeySlot struct {
+	Name      string
+	Public    []byte // the content key is encrypted for this key
+	Ephemeral []byte
+	Wrapped   []byte // the encrypted content key
+	Salt      []byte // password slots only: password salt
+	Private   []byte // password slots only: private key encrypted with the password
+}
+
+// NewPasswordSlot creates a slot that is unlocked with a password
+func NewPasswordSlot(name string, password, contentKey []byte) (*KeySlot, error) {
+	private, err := GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	salt := secureRandom(PASSWORD_SALT_SIZE)
+	enc, err := encryptBytes(GenerateKeyFromPassword(password, salt), private.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	slot := &KeySlot{
+		Name:    name,
+		Public:  private.PublicKey().Bytes(),
+		Salt:    salt,
+		Private: enc,
+	}
+	return slot, slot.wrap(contentKey)
+}
+
+// NewPublicKeySlot creates a slot that is unlocked with the private part of the given public key
+func NewPublicKeySlot(name string, public *ecdh.PublicKey, contentKey []byte) (*KeySlot, error) {
+	slot := &KeySlot{
+		Name:   name,
+		Public: public.Bytes(),
+	}
+	return slot, slot.wrap(contentKey)
+}
+
+// IsPassword returns true if this slot is unlocked with a password
+func (s KeySlot) IsPassword() bool {
+	return len(s.Salt) != 0
+}
+
+// Kind is a human-readable name for the slot type
+func (s KeySlot) Kind() string {
+	if s.IsPassword() {
+		return "password"
+	}
+	if s.Name == RECOVERY_MEMBER {
+		return "recovery key"
+	}
+	if s.Name == RECOVERY_SHARES {
+		return "recovery shares"
+	}
+	return "public key " + publicKeyEncoding.EncodeToString(s.Public)
+}
+
+// wrap encrypts the content key for this slot
+func (s *KeySlot) wrap(contentKey []byte) error {
+	public, err := ecdh.X25519().NewPublicKey(s.Public)
+	if err != nil {
+		return err
+	}
+	ephemeral, err := GenerateIdentity()
+	if err != nil {
+		return err
+	}
+
+	key, err := agreeKey(ephemeral, public, ephemeral.PublicKey(), public, KEYSLOT_INFO)
+	if err != nil {
+		return err
+	}
+	wrapped, err := encryptBytes(key, contentKey)
+	if err != nil {
+		return err
+	}
+	s.Ephemeral = ephemeral.PublicKey().Bytes()
+	s.Wrapped = wrapped
+	return nil
+}
+
+// unwrap decrypts the content key using the private key of this slot
+func (s KeySlot) unwrap(private *ecdh.PrivateKey) ([]byte, error) {
+	ephemeral, err := ecdh.X25519().NewPublicKey(s.Ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	key, err := agreeKey(private, ephemeral, ephemeral, private.PublicKey(), KEYSLOT_INFO)
+	if err != nil {
+		return nil, err
+	}
+	return decryptBytes(key, s.Wrapped)
+}
+
+// UnlockPassword returns the content key if the password is correct for this slot
+func (s KeySlot) UnlockPassword(password []byte) ([]byte, error) {
+	if !s.IsPassword() {
+		return nil, fmt.Errorf("not a password slot")
+	}
+	raw, err := decryptBytes(GenerateKeyFromPassword(password, s.Salt), s.Private)
+	if err != nil {
+		return nil, err
+	}
+	private, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, err
+	}
+	return s.unwrap(private)
+}
+
+// UnlockIdentity returns the content key if the private key belongs to this slot
+func (s KeySlot) UnlockIdentity(identity *ecdh.PrivateKey) ([]byte, error) {
+	if s.IsPassword() || !bytes.Equal(identity.PublicKey().Bytes(), s.Public) {
+		return nil, fmt.Errorf("key does not match slot")
+	}
+	return s.unwrap(identity)
+}
+
+func (s KeySlot) Serial(w io.Writer) error {
+	return WriteMultiple(w, BYTE_ORDER, s.Name, s.Public, s.Ephemeral, s.Wrapped, s.Salt, s.Private)
+}
+
+func (s *KeySlot) Deserial(r io.Reader) error {
+	return ReadMultiple(r, BYTE_ORDER, &s.Name, &s.Public, &s.Ephemeral, &s.Wrapped, &s.Salt, &s.Private)
+}
+
+// readSlots reads a list of key slots, starting with the slot count
+func readSlots(r io.Reader) ([]*KeySlot, error) {
+	var count uint32
+	if err := ReadOne(r, BYTE_ORDER, &count); err != nil {
+		return nil, err
+	}
+	if count > 100 {
+		return nil, fmt.Errorf("Too many key slots in database: %d", count)
+	}
+
+	var slots []*KeySlot
+	for i := 0; i < int(count); i++ {
+		slot := &KeySlot{}
+		if err := slot.Deserial(r); err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// writeSlots writes a list of key slots, starting with the slot count
+func writeSlots(w io.Writer, slots []*KeySlot) error {
+	if err := WriteOne(w, BYTE_ORDER, uint32(len(slots))); err != nil {
+		return err
+	}
+	for _, slot := range slots {
+		if err := slot.Serial(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unlockSlots tries the password or key pair on every slot, returns the content key and the slot that opened
+func unlockSlots(slots []*KeySlot, password []byte, identity *ecdh.PrivateKey) ([]byte, *KeySlot) {
+	for _, slot := range slots {
+		var key []byte
+		var err error
+		if identity != nil && !slot.IsPassword() {
+			key, err = slot.UnlockIdentity(identity)
+		} else if password != nil && slot.IsPassword() {
+			key, err = slot.UnlockPassword(password)
+		} else {
+			continue
+		}
+		if err == nil {
+			return key, slot
+		}
+	}
+	return nil, nil
+}
+
+// AddPasswordMember gives someone else access to the database using their own password (but doesn't save it)
+func (db *Database) AddPasswordMember(name, password string) error {
+	if err := db.checkNewMember(name); err != nil {
+		return err
+	}
+	slot, err := NewPasswordSlot(name, []byte(password), db.key)
+	if err != nil {
+		return err
+	}
+	db.Slots = append(db.Slots, slot)
+	return nil
+}
+
+// AddPublicKeyMember gives someone else access to the database using their key pair (but doesn't save it)
+func (db *Database) AddPublicKeyMember(name string, public *ecdh.PublicKey) error {
+	if err := db.checkNewMember(name); err != nil {
+		return err
+	}
+	slot, err := NewPublicKeySlot(name, public, db.key)
+	if err != nil {
+		return err
+	}
+	db.Slots = append(db.Slots, slot)
+	return nil
+}
+
+func (db Database) checkNewMember(name string) error {
+	if name == "" {
+		return fmt.Errorf("Member name cannot be empty")
+	}
+	if db.findSlot(name) != nil {
+		return fmt.Errorf("Member '%s' already exists", name)
+	}
+	return nil
+}
+
+// SetPassword replaces the password of a member, or adds a new password member (but doesn't save it)
+func (db *Database) SetPassword(name, password string) error {
+	slot, err := NewPasswordSlot(name, []byte(password), db.key)
+	if err != nil {
+		return err
+	}
+
+	for i, s := range db.Slots {
+		if s.Name == name {
+			if !s.IsPassword() {
+				return fmt.Errorf("Member '%s' does not use a password", name)
+			}
+			db.Slots[i] = slot
+			return nil
+		}
+	}
+	db.Slots = append(db.Slots, slot)
+	return nil
+}
+
+// NewRecoveryKey replaces the recovery slot with the given name with a new one (but doesn't save it).
+// The returned recovery key is the private key of the slot, it should be stored somewhere safe
+func (db *Database) NewRecoveryKey(name string) ([]byte, error) {
+	if db.findSlot(name) != nil {
+		if err := db.RemoveMember(name); err != nil {
+			return nil, err
+		}
+	}
+
+	recovery, err := GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AddPublicKeyMember(name, recovery.PublicKey()); err != nil {
+		return nil, err
+	}
+	return recovery.Bytes(), nil
+}
+
+// RemoveMember removes a member and rotates the content key (but doesn't save it),
+// the removed member will not be able to open future versions of the database
+func (db *Database) RemoveMember(name string) error {
+	slot := db.findSlot(name)
+	if slot == nil {
+		return fmt.Errorf("Member '%s' does not exist", name)
+	}
+	if slot == db.slot {
+		return fmt.Errorf("Cannot remove '%s', it was used to open the database", name)
+	}
+
+	var slots []*KeySlot
+	for _, s := range db.Slots {
+		if s != slot {
+			slots = append(slots, s)
+		}
+	}
+	db.Slots = slots
+	return db.rotateKey()
+}
+
+// rotateKey replaces the content key and encrypts it for all remaining slots
+func (db *Database) rotateKey() error {
+	key := secureRandom(CONTENT_KEY_SIZE)
+	for _, slot := range db.Slots {
+		if err := slot.wrap(key); err != nil {
+			return err
+		}
+	}
+	db.key = key
+	return nil
+}
+
+// findSlot finds a key slot by name
+func (db Database) findSlot(name string) *KeySlot {
+	for _, slot := range db.Slots {
+		if slot.Name == name {
+			return slot
+		}
+	}
+	return nil
+}
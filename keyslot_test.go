@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestKeySlots(t *testing.T) {
+	key := secureRandom(CONTENT_KEY_SIZE)
+	member := ensure(GenerateIdentity())
+	other := ensure(GenerateIdentity())
+
+	s1 := ensure(NewPasswordSlot("s1", []byte("password"), key))
+	s2 := ensure(NewPublicKeySlot("s2", member.PublicKey(), key))
+
+	if k, err := s1.UnlockPassword([]byte("password")); err != nil || !bytes.Equal(k, key) {
+		t.Errorf("Password slot failed to unlock: %v", err)
+	}
+	if _, err := s1.UnlockPassword([]byte("wrong password")); err == nil {
+		t.Errorf("Password slot unlocked with wrong password")
+	}
+	if k, err := s2.UnlockIdentity(member); err != nil || !bytes.Equal(k, key) {
+		t.Errorf("Public key slot failed to unlock: %v", err)
+	}
+	if _, err := s2.UnlockIdentity(other); err == nil {
+		t.Errorf("Public key slot unlocked with wrong key")
+	}
+
+	if k, s := unlockSlots([]*KeySlot{s1, s2}, nil, member); s != s2 || !bytes.Equal(k, key) {
+		t.Errorf("unlockSlots selected wrong slot: %v", s)
+	}
+	if k, s := unlockSlots([]*KeySlot{s1, s2}, []byte("wrong"), other); s != nil || k != nil {
+		t.Errorf("unlockSlots should fail with wrong password and key")
+	}
+}
+
+func TestMembers(t *testing.T) {
+	filename := t.TempDir() + "/team.tokdb"
+	member := ensure(GenerateIdentity())
+
+	db := ensure(CreateDatabase(filename, "owner password"))
+	add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+	if err := db.AddPasswordMember("alice", "alice password"); err != nil {
+		t.Fatalf("Unable to add member: %v", err)
+	}
+	if err := db.AddPublicKeyMember("bob", member.PublicKey()); err != nil {
+		t.Fatalf("Unable to add member: %v", err)
+	}
+	if err := db.AddPasswordMember("bob", "bob password"); err == nil {
+		t.Errorf("Member name collision was accepted")
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	// all three should be able to open it
+	db1 := ensure(LoadDatabase(filename, "owner password"))
+	db2 := ensure(LoadDatabase(filename, "alice password"))
+	db3 := ensure(LoadDatabaseWithIdentity(filename, member))
+	for _, d := range []*Database{db1, db2, db3} {
+		if len(d.Entries) != 1 || len(d.Slots) != 3 {
+			t.Errorf("Member database has wrong content: %v %v", d.Entries, d.Slots)
+		}
+	}
+
+	// remove bob, the key should be rotated
+	if err := db2.RemoveMember("alice"); err == nil {
+		t.Errorf("Member removed the slot used to open the database")
+	}
+	if err := db2.RemoveMember("bob"); err != nil {
+		t.Fatalf("Unable to remove member: %v", err)
+	}
+	if bytes.Equal(db1.key, db2.key) {
+		t.Errorf("Content key was not rotated")
+	}
+	if err := db2.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	if k, s := unlockSlots(db2.Slots, nil, member); s != nil || k != nil {
+		t.Errorf("Removed member can still open the database")
+	}
+	if d := ensure(LoadDatabase(filename, "owner password")); len(d.Slots) != 2 || !bytes.Equal(d.key, db2.key) {
+		t.Errorf("Remaining member could not open the rotated database")
+	}
+}
+
+func TestRecoveryKey(t *testing.T) {
+	filename := t.TempDir() + "/test.tokdb"
+
+	db := ensure(CreateDatabase(filename, "forgotten password"))
+	add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+	key, err := db.NewRecoveryKey(RECOVERY_MEMBER)
+	if err != nil {
+		t.Fatalf("Unable to create recovery key: %v", err)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	db2, err := LoadDatabaseWithRecoveryKey(filename, key)
+	if err != nil {
+		t.Fatalf("Unable to open database with recovery key: %v", err)
+	}
+	if err := db2.SetPassword(DEFAULT_MEMBER, "new password"); err != nil {
+		t.Fatalf("Unable to set password: %v", err)
+	}
+	if err := db2.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	db3 := ensure(LoadDatabase(filename, "new password"))
+	if len(db3.Entries) != 1 || len(db3.Slots) != 2 || db3.slot.Name != DEFAULT_MEMBER {
+		t.Errorf("Unexpected database after recovery: %v %v", db3.Entries, db3.Slots)
+	}
+	if k, _ := unlockSlots(db3.Slots, []byte("forgotten password"), nil); k != nil {
+		t.Errorf("Old password still works")
+	}
+
+	// a new recovery key replaces the old one
+	if _, err := db3.NewRecoveryKey(RECOVERY_MEMBER); err != nil {
+		t.Fatalf("Unable to create recovery key: %v", err)
+	}
+	if len(db3.Slots) != 2 {
+		t.Errorf("Old recovery slot was not removed: %v", db3.Slots)
+	}
+}
+
+func TestCreatedRecoveryKey(t *testing.T) {
+	filename := t.TempDir() + "/test.tokdb"
+	db := ensure(CreateDatabase(filename, "password"))
+	out := new(bytes.Buffer)
+	if err := createRecoveryKey(db, out); err != nil {
+		t.Fatalf("Unable to create recovery key: %v", err)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Recovery key was shown before the database was saved")
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+	fields := strings.Fields(out.String())
+	if len(fields) < 5 {
+		t.Fatalf("Recovery key was not shown: %s", out)
+	}
+	share := ensure(ShareFromString(fields[4]))
+
+	// splitting a recovery key doesn't replace the one made with the database
+	if _, err := db.NewRecoveryKey(RECOVERY_SHARES); err != nil {
+		t.Fatalf("Unable to split recovery key: %v", err)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+	if strings.Count(out.String(), "recovery key") != 1 {
+		t.Errorf("Recovery key was shown twice: %s", out)
+	}
+	key := ensure(ShamirCombine([][]byte{share}))
+	if _, err := LoadDatabaseWithRecoveryKey(filename, key); err != nil {
+		t.Errorf("Recovery key made with the database does not work: %v", err)
+	}
+}
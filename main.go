@@ -1,11 +1,19 @@
 package main
 
 import (
+	"bufio"
+	"encoding/base32"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
-	"path"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const (
@@ -14,6 +22,8 @@ const (
 	DEFAULT_DIGITS    = 6
 	DEFAULT_PERIOD    = 30
 	DEFAULT_TIME      = 30
+
+	DEFAULT_SECRET_LENGTH = 20
 )
 
 // Config is the current application configuration
@@ -26,6 +36,38 @@ type Config struct {
 	password         string
 	Verbose          bool
 	Time             int
+	Duplicates       string
+	Recipient        string
+	Output           string
+	IdentityFilename string
+	Shares           int
+	Threshold        int
+	Window           int
+	Listen           string
+	MaxFailures      int
+	RadiusListen     string
+	RadiusNoMA       bool
+	Pin              string
+	Issuer           string
+	SecretLength     int
+	VerifyNew        bool
+	CheckJournal     bool
+	TimeOffset       string
+	At               string
+	Next             int
+	Prev             int
+	Suite            string
+	Session          string
+	Type             string
+	NewName          string
+	Note             string
+	Folder           string
+	Tag              string
+	Tree             bool
+	Yes              bool
+
+	// set contains the options given on the command line
+	set map[string]bool
 }
 
 // Password returns the database password.
@@ -44,6 +86,18 @@ func (c *Config) Password() (string, error) {
 	return c.password, nil
 }
 
+// Clock returns the clock to use with the database, the -time-offset option overrides the stored offset
+func (c *Config) Clock(db *Database) (Clock, error) {
+	if c.TimeOffset == "" {
+		return OffsetClock(db.ClockOffset), nil
+	}
+	offset, err := time.ParseDuration(c.TimeOffset)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid time offset '%s': %v", c.TimeOffset, err)
+	}
+	return OffsetClock(offset), nil
+}
+
 func usage() {
 	name := os.Args[0]
 	out := flag.CommandLine.Output()
@@ -55,15 +109,54 @@ func usage() {
 	fmt.Fprintf(out, "COMMANDS:\n"+
 		"    add <NAME>\n"+
 		"    add <NAME> <KEY> [NOTE]\n"+
+		"    add <NAME> <KEY> -suite <OCRA SUITE> [-pin PIN]\n"+
+		"    add <NAME> <KEY> -type hotp|steam\n"+
+		"    add <NAME> <KEY> -type motp|yandex -pin <PIN>\n"+
+		"    new <NAME> [-issuer ISSUER] [-folder FOLDER] [-length BYTES] [-verify]\n"+
 		"    import otpauth://totp/...\n"+
+		"    import <FILE> (one URI per line, use - for stdin)\n"+
+		"    import <FILE.maFile> (Steam Guard secret)\n"+
 		"    export <NAME>\n"+
-		"    rm <name>\n"+
-		"    ls\n"+
+		"    edit <NAME> [-name NAME] [-note NOTE] [-issuer ISSUER] [-folder FOLDER] [-hash H] [-period P] [-digits D]\n"+
+		"    edit <NAME> (asks for each value)\n"+
+		"    rm <name> [-y] (asks for confirmation if the name is not exact)\n"+
+		"    trash ls\n"+
+		"    trash restore|purge <NAME>|#<N> [-y]\n"+
+		"    trash purge [-y] (purge all removed entries)\n"+
+		"    trash retention [DAYS] (show or set how long removed entries are kept, 0 is forever)\n"+
+		"    log [NAME] (show the changes to all entries or one entry)\n"+
+		"    log -verify (check that the journal has not been tampered with)\n"+
+		"    merge <OTHER DATABASE> [-y] (bring in the changes made in another copy)\n"+
+		"    convert <PATH> (save a copy, a PATH ending with / is a directory with one file per entry)\n"+
+		"    tag add|rm <NAME> <TAG>\n"+
+		"    mv <NAME> <POSITION> (change the order shown by ls and used by #N)\n"+
+		"    keygen\n"+
+		"    share <NAME>... -to <PUBLIC KEY> [-o FILE]\n"+
+		"    receive <FILE>\n"+
+		"    members ls\n"+
+		"    members add <NAME> [PUBLIC KEY]\n"+
+		"    members rm <NAME>\n"+
+		"    slot ls|add|rm ... (same as members ...)\n"+
+		"    recovery split [-n SHARES] [-k NEEDED] [-y] (the recovery key made with the database keeps working)\n"+
+		"    recovery unlock [MEMBER]\n"+
+		"    ls [-tag TAG] [-folder FOLDER] [-tree]\n"+
 		"    show <NAME>\n"+
+		"    show #<N>|@<ID> (by position in ls, or by unique id prefix from ls -v)\n"+
+		"    show <SEARCH> (search can include tag:TAG, folder:FOLDER and issuer:ISSUER)\n"+
+		"    show <NAME> [-at TIME] [-next N] [-prev N] (list codes around a time)\n"+
+		"    verify <NAME>|#<N>|@<ID> <CODE> (the name must be exact, use - to read code from stdin, exits with 1 if invalid)\n"+
+		"    serve [-listen ADDRESS]\n"+
+		"    radius [-radius ADDRESS] [-radius-no-ma]\n"+
+		"    ocra <NAME> <CHALLENGE> [-pin PIN] [-session HEX]\n"+
+		"    clock (show the stored clock offset)\n"+
+		"    clock check <URL> (compare with the Date header from a HTTP server)\n"+
+		"    clock check <NAME> (compare with a code from a device with a correct clock)\n"+
+		"    clock set <OFFSET> (store an offset such as 42s or -1m30s, 0 to remove it)\n"+
 		"    <NAME> (same as show <NAME>)\n",
 	)
 	fmt.Fprintf(out, "Environment:\n"+
-		"    TOK_PASSWORD: database password, if you don't want to read it from command line\n",
+		"    TOK_PASSWORD: database password, if you don't want to read it from command line\n"+
+		"    TOK_RADIUS_SECRET: RADIUS shared secret, if you don't want to read it from command line\n",
 	)
 }
 
@@ -73,7 +166,7 @@ func parseParams() (*Config, []string) {
 	if err != nil {
 		log.Fatalf("You are homeless: %v\n", err)
 	}
-	defaultDbFile := path.Join(home, DATABASE_FILENAME)
+	defaultDbFile := DefaultDatabasePath(home)
 
 	filename := flag.String("db", defaultDbFile, "the database")
 	time := flag.Int("time", DEFAULT_TIME, "display time")
@@ -81,11 +174,40 @@ func parseParams() (*Config, []string) {
 	digits := flag.Int("digits", DEFAULT_DIGITS, "token digits")
 	hashname := flag.String("hash", DEFAULT_HASH, "TOTP hash algorithm")
 	verbose := flag.Bool("v", false, "verbose output")
+	duplicates := flag.String("dup", "skip", "how to import duplicates: skip, rename or replace")
+	recipient := flag.String("to", "", "public key of the recipient when sharing")
+	output := flag.String("o", "share.tok", "output file when sharing")
+	shares := flag.Int("n", 5, "number of recovery shares")
+	threshold := flag.Int("k", 3, "number of recovery shares needed to unlock")
+	window := flag.Int("window", 1, "periods of clock skew allowed when verifying")
+	listen := flag.String("listen", "127.0.0.1:8632", "address for serve, either loopback or unix:/path/to/socket")
+	maxFailures := flag.Int("lockout", SERVE_MAX_FAILURES, "failures before serve locks an entry")
+	radiusListen := flag.String("radius", "127.0.0.1:1812", "UDP address for the RADIUS server")
+	radiusNoMA := flag.Bool("radius-no-ma", false, "accept RADIUS requests without a Message-Authenticator, for old clients")
+	pin := flag.String("pin", "", "PIN to add to a new entry, used in PIN+code logins and OCRA")
+	issuer := flag.String("issuer", "", "issuer of a new entry")
+	secretLength := flag.Int("length", DEFAULT_SECRET_LENGTH, "secret length in bytes for new")
+	// -verify is given to the command it is used with, see VerifyNew and CheckJournal
+	verify := flag.Bool("verify", false, "ask for a code from the enrolled device before saving a new entry, or check the journal in log")
+	timeOffset := flag.String("time-offset", "", "correction for the local clock, such as 42s or -1m30s (default is the offset stored in the database)")
+	at := flag.String("at", "", "show codes at this time instead of now, such as 2026-10-18T14:02:00Z")
+	next := flag.Int("next", 0, "also show the codes for this many following periods")
+	prev := flag.Int("prev", 0, "also show the codes for this many previous periods")
+	newName := flag.String("name", "", "new name for edit")
+	note := flag.String("note", "", "new note for edit")
+	folder := flag.String("folder", "", "folder such as work/aws for add and edit, or to only list this folder")
+	tag := flag.String("tag", "", "only list entries with this tag")
+	tree := flag.Bool("tree", false, "list entries as a tree of folders")
+	yes := flag.Bool("y", false, "don't ask for confirmation")
+	entryType := flag.String("type", "totp", "type of entry for add: totp, hotp, steam, motp or yandex")
+	suite := flag.String("suite", "", "OCRA suite for add, such as OCRA-1:HOTP-SHA1-6:QN08")
+	session := flag.String("session", "", "hex encoded OCRA session information")
+	identity := flag.String("identity", "", "open the database with the key pair from this database instead of a password")
 
 	flag.Usage = usage
 	flag.Parse()
 
-	args := flag.Args()
+	args := interspersedArgs(flag.CommandLine, flag.Args())
 	if len(args) == 0 {
 		flag.Usage()
 		os.Exit(20)
@@ -98,34 +220,133 @@ func parseParams() (*Config, []string) {
 		HashAlgorithm:    *hashname,
 		Verbose:          *verbose,
 		Time:             *time,
+		Duplicates:       *duplicates,
+		Recipient:        *recipient,
+		Output:           *output,
+		IdentityFilename: *identity,
+		Shares:           *shares,
+		Threshold:        *threshold,
+		Window:           *window,
+		Listen:           *listen,
+		MaxFailures:      *maxFailures,
+		RadiusListen:     *radiusListen,
+		RadiusNoMA:       *radiusNoMA,
+		Pin:              *pin,
+		Issuer:           *issuer,
+		SecretLength:     *secretLength,
+		VerifyNew:        *verify && args[0] == "new",
+		CheckJournal:     *verify && args[0] == "log",
+		TimeOffset:       *timeOffset,
+		At:               *at,
+		Next:             *next,
+		Prev:             *prev,
+		Suite:            *suite,
+		Session:          *session,
+		Type:             *entryType,
+		NewName:          *newName,
+		Note:             *note,
+		Folder:           *folder,
+		Tag:              *tag,
+		Tree:             *tree,
+		Yes:              *yes,
+		set:              make(map[string]bool),
 	}
+	flag.Visit(func(f *flag.Flag) {
+		cfg.set[f.Name] = true
+	})
 
 	return cfg, args
 }
 
+// interspersedArgs allows options to also appear after the command, e.g. "tok import - -dup rename".
+// Negative values such as "clock set -1m30s" are arguments, and so is everything after "--"
+func interspersedArgs(flags *flag.FlagSet, args []string) []string {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+
+	var ret []string
+	for len(args) > 0 {
+		ret = append(ret, args[0])
+		args = args[1:]
+		for len(args) > 0 && isNegativeValue(args[0]) {
+			ret = append(ret, args[0])
+			args = args[1:]
+		}
+		flags.Parse(args) // exits on error
+		args = flags.Args()
+	}
+	return append(ret, rest...)
+}
+
+// isNegativeValue is true for arguments like -42 or -1m30s, no option starts with a digit
+func isNegativeValue(arg string) bool {
+	return len(arg) > 1 && arg[0] == '-' && (arg[1] >= '0' && arg[1] <= '9' || arg[1] == '.')
+}
+
 func getDatabase(cfg *Config, allowCreate bool) (*Database, error) {
 	password, err := cfg.Password()
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.IdentityFilename != "" {
+		personal, err := LoadDatabase(cfg.IdentityFilename, password)
+		if err != nil {
+			return nil, err
+		}
+		if personal.identity == nil {
+			return nil, fmt.Errorf("%s has no key pair, run keygen first", cfg.IdentityFilename)
+		}
+		return LoadDatabaseWithIdentity(cfg.DatabaseFilename, personal.identity)
+	}
+
 	db, err := LoadDatabase(cfg.DatabaseFilename, password)
 	if err != nil {
 		if !allowCreate {
 			return nil, err
 		}
 		log.Printf("Warning: could not load old database: %v\n", err)
-		db, err = CreateDatabase(cfg.DatabaseFilename, password)
+		if db, err = CreateDatabase(cfg.DatabaseFilename, password); err != nil {
+			return nil, err
+		}
+		err = createRecoveryKey(db, os.Stdout)
 	}
 	return db, err
 }
 
+// createRecoveryKey adds a recovery key to a new database, it is shown to the
+// user once the database has been saved
+func createRecoveryKey(db *Database, out io.Writer) error {
+	key, err := db.NewRecoveryKey(RECOVERY_MEMBER)
+	if err != nil {
+		return err
+	}
+	share, err := ShamirSplit(key, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	db.onSave = func() {
+		fmt.Fprintf(out, "Your recovery key is:\n\n    %s\n\n", ShareToString(share[0]))
+		fmt.Fprintf(out, "Keep it somewhere safe, it can be used with 'recovery unlock' if you forget your password\n")
+	}
+	return nil
+}
+
 func addEntry(cfg *Config, entry *Entry) error {
 	db, err := getDatabase(cfg, true)
 	if err != nil {
 		return err
 	}
 
+	if entry.Folder == "" {
+		entry.Folder = cleanFolder(cfg.Folder)
+	}
 	if err := db.Add(entry); err != nil {
 		return err
 	}
@@ -134,23 +355,277 @@ func addEntry(cfg *Config, entry *Entry) error {
 	if err := db.Save(); err != nil {
 		return err
 	}
-	return showEntry(cfg.Time, entry)
+	// only show codes that don't need to be used
+	if g, err := entry.Generator(); err != nil || g.CounterBased() {
+		fmt.Printf("Added '%s'\n", entry.Name)
+		return nil
+	}
+	clock, err := cfg.Clock(db)
+	if err != nil {
+		return err
+	}
+	return showEntry(clock, cfg.Time, entry)
 }
 
 func cmdAdd(cfg *Config, name, secret, note string) error {
-	entry, err := NewEntry(name, secret, cfg.HashAlgorithm, note, cfg.Period, cfg.Digits)
+	// OCRA entries are described by their suite
+	if cfg.Suite != "" {
+		suite, err := ParseOcraSuite(cfg.Suite)
+		if err != nil {
+			return err
+		}
+		entry, err := NewEntry(name, secret, cfg.HashAlgorithm, note, cfg.Period, cfg.Digits)
+		if err != nil {
+			return err
+		}
+		entry.Pin = cfg.Pin
+		entry.Type = ENTRY_OCRA
+		entry.Suite = suite.Suite
+		entry.Digits = uint8(suite.Digits)
+		return addEntry(cfg, entry)
+	}
+
+	entryType, err := generatorTypeByOption(cfg.Type)
+	if err != nil {
+		return err
+	}
+	entry, err := NewTypedEntry(entryType, name, secret, cfg.HashAlgorithm, note, cfg.Pin, cfg.Period, cfg.Digits)
 	if err != nil {
 		return err
 	}
 	return addEntry(cfg, entry)
 }
 
-func cmdImport(cfg *Config, uristr string) error {
-	entry, err := EntryFromUri(uristr)
+func cmdNew(cfg *Config, name string) error {
+	if cfg.SecretLength < 16 || cfg.SecretLength > 64 {
+		return fmt.Errorf("Invalid secret length: %d, use 16 to 64 bytes", cfg.SecretLength)
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secureRandom(cfg.SecretLength))
+
+	entry, err := NewEntry(name, secret, cfg.HashAlgorithm, "", cfg.Period, cfg.Digits)
 	if err != nil {
 		return err
 	}
-	return addEntry(cfg, entry)
+	entry.Issuer = cfg.Issuer
+	entry.Pin = cfg.Pin
+	entry.Folder = cleanFolder(cfg.Folder)
+
+	db, err := getDatabase(cfg, true)
+	if err != nil {
+		return err
+	}
+	if err := db.Add(entry); err != nil {
+		return err
+	}
+
+	uri, err := EntryToUri(entry)
+	if err != nil {
+		return err
+	}
+	if err := showQr(uri); err != nil {
+		return err
+	}
+
+	if cfg.VerifyNew {
+		clock, err := cfg.Clock(db)
+		if err != nil {
+			return err
+		}
+		code, err := ReadInput("Enter the code shown on the new device: ", false)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Verify(strings.TrimSpace(code), clock(), cfg.Window); err != nil {
+			return fmt.Errorf("verification failed, '%s' was not saved: %v", name, err)
+		}
+	}
+
+	if err := db.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Added '%s'\n", name)
+	return nil
+}
+
+func cmdImport(cfg *Config, source string) error {
+	mode, err := duplicateModeFromName(cfg.Duplicates)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasSuffix(strings.ToLower(source), ".mafile") {
+		return cmdImportSteam(cfg, source, mode)
+	}
+
+	var r io.Reader
+	if strings.Contains(source, "://") {
+		r = strings.NewReader(source)
+	} else if source == "-" {
+		r = os.Stdin
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	db, err := getDatabase(cfg, true)
+	if err != nil {
+		return err
+	}
+
+	results, err := db.Import(r, mode)
+	showImportResults(results)
+	if err != nil {
+		return err
+	}
+	return db.Save()
+}
+
+// cmdImportSteam imports the secret from a Steam Desktop Authenticator .maFile
+func cmdImportSteam(cfg *Config, filename string, mode DuplicateMode) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entry, err := EntryFromSteamFile(f)
+	if err != nil {
+		return err
+	}
+
+	db, err := getDatabase(cfg, true)
+	if err != nil {
+		return err
+	}
+	results := db.Merge([]*Entry{entry}, mode)
+	showImportResults(results)
+	if results[0].Err != nil {
+		return results[0].Err
+	}
+	return db.Save()
+}
+
+func cmdEdit(cfg *Config, name string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	entries, err := db.Find(name)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 {
+		return fmt.Errorf("could not select unique item '%s'", name)
+	}
+	entry := entries[0]
+
+	var changes EntryChanges
+	if cfg.set["name"] {
+		changes.Name = &cfg.NewName
+	}
+	if cfg.set["note"] {
+		changes.Note = &cfg.Note
+	}
+	if cfg.set["issuer"] {
+		changes.Issuer = &cfg.Issuer
+	}
+	if cfg.set["folder"] {
+		changes.Folder = &cfg.Folder
+	}
+	if cfg.set["hash"] {
+		changes.Hash = &cfg.HashAlgorithm
+	}
+	if cfg.set["period"] {
+		changes.Period = &cfg.Period
+	}
+	if cfg.set["digits"] {
+		changes.Digits = &cfg.Digits
+	}
+
+	// without options, ask for each value
+	if changes == (EntryChanges{}) {
+		if changes, err = askChanges(entry); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Edit(entry, changes); err != nil {
+		return err
+	}
+	if err := db.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Updated '%s'\n", entry.Name)
+	return nil
+}
+
+// confirm asks the user to confirm an action, unless -y was given
+func confirm(cfg *Config, prompt string) error {
+	if cfg.Yes {
+		return nil
+	}
+	answer, err := ReadInput(prompt+" [y/N]: ", false)
+	if err != nil {
+		return err
+	}
+	if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+		return fmt.Errorf("Cancelled")
+	}
+	return nil
+}
+
+// askChanges asks for new values, showing the current ones. An empty answer keeps the value
+func askChanges(entry *Entry) (EntryChanges, error) {
+	var changes EntryChanges
+	ask := func(prompt, current string) (*string, error) {
+		answer, err := ReadInput(fmt.Sprintf("%s [%s]: ", prompt, current), false)
+		if err != nil || answer == "" || answer == current {
+			return nil, err
+		}
+		return &answer, nil
+	}
+	askInt := func(prompt string, current int) (*int, error) {
+		answer, err := ask(prompt, strconv.Itoa(current))
+		if err != nil || answer == nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(*answer)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s: %s", strings.ToLower(prompt), *answer)
+		}
+		return &n, nil
+	}
+
+	var err error
+	if changes.Name, err = ask("Name", entry.Name); err != nil {
+		return changes, err
+	}
+	if changes.Note, err = ask("Note", entry.Note); err != nil {
+		return changes, err
+	}
+	if changes.Issuer, err = ask("Issuer", entry.Issuer); err != nil {
+		return changes, err
+	}
+	if changes.Folder, err = ask("Folder", entry.Folder); err != nil {
+		return changes, err
+	}
+	if entry.Editable() {
+		if changes.Hash, err = ask("Algorithm", hashToName(entry.Hash)); err != nil {
+			return changes, err
+		}
+		if changes.Period, err = askInt("Period", int(entry.Period)); err != nil {
+			return changes, err
+		}
+		if changes.Digits, err = askInt("Digits", int(entry.Digits)); err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
 }
 
 func cmdExport(cfg *Config, name string) error {
@@ -167,26 +642,48 @@ func cmdExport(cfg *Config, name string) error {
 	if len(entries) == 0 {
 		return fmt.Errorf("unable to find '%s'", name)
 	}
-	showEntries(true, false, entries)
-	return nil
+	exported := showEntries(true, false, entries, db.Entries)
+	if len(exported) == 0 {
+		return fmt.Errorf("none of the items matching '%s' can be exported", name)
+	}
+	for _, e := range exported {
+		db.Record(JOURNAL_EXPORT, e)
+	}
+	return db.Save()
 }
 
-func cmdRemove(cfg *Config, name string) error {
+func cmdTag(cfg *Config, action, name, tag string) error {
 	db, err := getDatabase(cfg, false)
 	if err != nil {
 		log.Fatalf("Internal error: %v\n", err)
 	}
 
-	e := db.Delete(name)
-	if e == nil {
-		return fmt.Errorf("entry '%s' does not exist", name)
+	entries, err := db.Find(name)
+	if err != nil {
+		return err
 	}
+	if len(entries) != 1 {
+		return fmt.Errorf("could not select unique item '%s'", name)
+	}
+	entry := entries[0]
 
-	fmt.Printf("Removed %s\n", e.Name)
+	switch action {
+	case "add":
+		err = entry.AddTag(tag)
+	case "rm":
+		err = entry.RemoveTag(tag)
+	default:
+		usage()
+		os.Exit(20)
+	}
+	if err != nil {
+		return err
+	}
+	db.Record(JOURNAL_EDIT, entry)
 	return db.Save()
 }
 
-func cmdSearch(cfg *Config, name string) error {
+func cmdMove(cfg *Config, name, position string) error {
 	db, err := getDatabase(cfg, false)
 	if err != nil {
 		log.Fatalf("Internal error: %v\n", err)
@@ -196,72 +693,865 @@ func cmdSearch(cfg *Config, name string) error {
 	if err != nil {
 		return err
 	}
+	if len(entries) != 1 {
+		return fmt.Errorf("could not select unique item '%s'", name)
+	}
+	n, err := strconv.Atoi(position)
+	if err != nil {
+		return fmt.Errorf("Invalid position '%s'", position)
+	}
 
-	switch len(entries) {
-	case 0:
-		return fmt.Errorf("unable to find '%s'", name)
-	case 1:
-		return showEntry(cfg.Time, entries[0])
-	default:
-		showEntries(false, false, entries)
-		return fmt.Errorf("multiple items matching '%s'", name)
+	if err := db.Move(entries[0], n); err != nil {
+		return err
 	}
+	fmt.Printf("Moved '%s' to #%d\n", entries[0].Name, n)
+	return db.Save()
 }
 
-func cmdList(cfg *Config) error {
+func cmdRemove(cfg *Config, name string) error {
 	db, err := getDatabase(cfg, false)
 	if err != nil {
 		log.Fatalf("Internal error: %v\n", err)
 	}
 
-	showEntries(false, cfg.Verbose, db.Entries)
-	return nil
+	matches, err := db.Search(name)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("entry '%s' does not exist", name)
+	}
+	if len(matches) != 1 {
+		return fmt.Errorf("could not select unique item '%s'", name)
+	}
+	e := matches[0].Entry
+
+	// a fuzzy match may not be the entry the user meant
+	if matches[0].Score != SCORE_EXACT {
+		if err := confirm(cfg, fmt.Sprintf("Remove '%s'?", e.Name)); err != nil {
+			return err
+		}
+	}
+
+	if err := db.Delete(e); err != nil {
+		return err
+	}
+	fmt.Printf("Removed %s, use 'trash restore' to undo\n", e.Name)
+	return db.Save()
 }
 
-func main() {
-	cfg, args := parseParams()
-	cmd, params := args[0], args[1:]
+func cmdTrash(cfg *Config, params []string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
 
-	// check if we received the correct number of parameters
-	n := len(params)
-	if (cmd == "add" && n > 3) ||
-		(cmd == "import" && n != 1) ||
-		(cmd == "export" && n != 1) ||
-		(cmd == "rm" && n != 1) ||
-		(cmd == "ls" && n != 0) ||
-		(cmd == "show" && n != 1) {
-		usage()
-		os.Exit(20)
+	// find exactly one item in the trash
+	find := func(name string) (*TrashItem, error) {
+		items, err := db.FindTrash(name)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) != 1 {
+			return nil, fmt.Errorf("could not select unique item '%s' in trash, use #N from 'trash ls'", name)
+		}
+		return items[0], nil
 	}
 
-	var err error
-	switch cmd {
-	case "add":
-		params = append(params, "", "", "") // make room for missing or optional parameters
-		name, secret, notes := params[0], params[1], params[2]
-		if n == 0 {
-			name, err = ReadInput("Enter name: ", false)
+	switch {
+	case params[0] == "ls" && len(params) == 1:
+		showTrash(db.Trash, db.TrashDays)
+		return nil
+
+	case params[0] == "restore" && len(params) == 2:
+		item, err := find(params[1])
+		if err != nil {
+			return err
 		}
-		if err == nil && n < 2 {
-			secret, err = ReadInput("Enter secret: ", false)
+		if err := db.Restore(item); err != nil {
+			return err
 		}
+		fmt.Printf("Restored '%s'\n", item.Entry.Name)
 
-		if err == nil && n < 2 { // not 3, user name choose to not add a note
-			notes, err = ReadInput("Enter note: ", false)
+	case params[0] == "purge" && len(params) == 2:
+		item, err := find(params[1])
+		if err != nil {
+			return err
 		}
-		if err == nil {
-			err = cmdAdd(cfg, name, secret, notes)
+		if err := confirm(cfg, fmt.Sprintf("Purge '%s' for good?", item.Entry.Name)); err != nil {
+			return err
 		}
+		if err := db.Purge(item); err != nil {
+			return err
+		}
+
+	case params[0] == "purge" && len(params) == 1:
+		if err := confirm(cfg, fmt.Sprintf("Purge all %d removed entries for good?", len(db.Trash))); err != nil {
+			return err
+		}
+		db.PurgeAll()
+
+	case params[0] == "retention" && len(params) == 1:
+		fmt.Printf("Removed entries are kept for %d days (0 means until purged)\n", db.TrashDays)
+		return nil
+
+	case params[0] == "retention" && len(params) == 2:
+		days, err := strconv.ParseUint(params[1], 10, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid number of days '%s'", params[1])
+		}
+		db.TrashDays = uint32(days)
+		db.purgeExpired(time.Now())
+
+	default:
+		usage()
+		os.Exit(20)
+	}
+	return db.Save()
+}
+
+func cmdLog(cfg *Config, params []string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	if cfg.CheckJournal {
+		if err := VerifyJournal(db.JournalStart, db.Journal); err != nil {
+			return err
+		}
+		fmt.Printf("The journal is intact, %d records\n", len(db.Journal))
+		return nil
+	}
+
+	records := db.Journal
+	if len(params) == 1 {
+		name := params[0]
+		matches, err := db.Search(name)
+		if err != nil {
+			return err
+		}
+		var entries []*Entry
+		for _, m := range matches {
+			entries = append(entries, m.Entry)
+		}
+
+		// the entry may also be in the trash, an exact name there wins over fuzzy matches
+		if len(matches) == 0 || matches[0].Score != SCORE_EXACT {
+			items, err := db.FindTrash(name)
+			if err != nil {
+				return err
+			}
+			if len(items) != 0 && (len(entries) == 0 || strings.EqualFold(items[0].Entry.Name, name)) {
+				entries = nil
+				for _, item := range items {
+					entries = append(entries, item.Entry)
+				}
+			}
+		}
+		if len(entries) != 1 {
+			return fmt.Errorf("could not select unique item '%s'", params[0])
+		}
+		records = db.History(entries[0].Id)
+	}
+	showJournal(records)
+	return nil
+}
+
+func cmdMerge(cfg *Config, filename string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	password, err := ReadInput(fmt.Sprintf("Enter password for %s (empty for the same password): ", filename), true)
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		password = cfg.password
+	}
+	other, err := LoadDatabase(filename, password)
+	if err != nil {
+		return err
+	}
+
+	changes := db.PlanSync(other)
+	if len(changes) == 0 {
+		fmt.Printf("Nothing to merge from %s\n", filename)
+		return nil
+	}
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	if err := confirm(cfg, fmt.Sprintf("Apply %d changes?", len(changes))); err != nil {
+		return err
+	}
+
+	if err := db.ApplySync(other, changes); err != nil {
+		return err
+	}
+	return db.Save()
+}
+
+func cmdConvert(cfg *Config, path string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	storage := OpenStorage(path)
+	if _, err := storage.Stat(); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	db.filename = path
+	db.storage = storage
+	if err := db.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Saved %d entries to %s\n", len(db.Entries), path)
+	return nil
+}
+
+func cmdKeygen(cfg *Config) error {
+	db, err := getDatabase(cfg, true)
+	if err != nil {
+		return err
+	}
+
+	if db.identity == nil {
+		if db.identity, err = GenerateIdentity(); err != nil {
+			return err
+		}
+		if err := db.Save(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Your public key is %s\n", PublicKeyToString(db.identity.PublicKey()))
+	return nil
+}
+
+func cmdShare(cfg *Config, names []string) error {
+	recipient, err := PublicKeyFromString(cfg.Recipient)
+	if err != nil {
+		return err
+	}
+
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	var entries []*Entry
+	for _, name := range names {
+		found, err := db.Find(name)
+		if err != nil {
+			return err
+		}
+		if len(found) != 1 {
+			return fmt.Errorf("could not select unique item '%s'", name)
+		}
+		entries = append(entries, found[0])
+	}
+
+	data, err := SealBundle(recipient, entries)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(cfg.Output, data, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Shared %d entries in %s\n", len(entries), cfg.Output)
+	for _, e := range entries {
+		db.Record(JOURNAL_SHARE, e)
+	}
+	return db.Save()
+}
+
+func cmdReceive(cfg *Config, filename string) error {
+	mode, err := duplicateModeFromName(cfg.Duplicates)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+	if db.identity == nil {
+		return fmt.Errorf("database has no key pair, run keygen first")
+	}
+
+	entries, err := OpenBundle(db.identity, data)
+	if err != nil {
+		return err
+	}
+
+	showImportResults(db.Merge(entries, mode))
+	return db.Save()
+}
+
+func cmdMembers(cfg *Config, params []string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	switch {
+	case params[0] == "ls" && len(params) == 1:
+		showSlots(db.Slots, db.slot)
+		return nil
+	case params[0] == "add" && len(params) == 3:
+		public, err := PublicKeyFromString(params[2])
+		if err != nil {
+			return err
+		}
+		if err := db.AddPublicKeyMember(params[1], public); err != nil {
+			return err
+		}
+	case params[0] == "add" && len(params) == 2:
+		password, err := ReadInput(fmt.Sprintf("Enter password for %s: ", params[1]), true)
+		if err != nil {
+			return err
+		}
+		if err := db.AddPasswordMember(params[1], password); err != nil {
+			return err
+		}
+	case params[0] == "rm" && len(params) == 2:
+		if err := db.RemoveMember(params[1]); err != nil {
+			return err
+		}
+	default:
+		usage()
+		os.Exit(20)
+	}
+
+	if err := db.Save(); err != nil {
+		return err
+	}
+	showSlots(db.Slots, db.slot)
+	return nil
+}
+
+func cmdRecoverySplit(cfg *Config) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	if db.findSlot(RECOVERY_SHARES) != nil {
+		if err := confirm(cfg, "This replaces the existing recovery shares, they will stop working. Continue?"); err != nil {
+			return err
+		}
+	}
+	key, err := db.NewRecoveryKey(RECOVERY_SHARES)
+	if err != nil {
+		return err
+	}
+	shares, err := ShamirSplit(key, cfg.Shares, cfg.Threshold)
+	if err != nil {
+		return err
+	}
+	if err := db.Save(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Give one share to each keeper, any %d of them can unlock the database:\n\n", cfg.Threshold)
+	for i, share := range shares {
+		fmt.Printf("Share %d of %d:\n    %s\n\n", i+1, len(shares), ShareToString(share))
+	}
+	return nil
+}
+
+func cmdRecoveryUnlock(cfg *Config, member string) error {
+	// the first share tells us how many are needed, the recovery key is a single share
+	var shares [][]byte
+	for len(shares) == 0 || len(shares) < int(shares[0][0]) {
+		prompt := "Enter recovery key or share 1: "
+		if len(shares) > 0 {
+			prompt = fmt.Sprintf("Enter share %d: ", len(shares)+1)
+		}
+		str, err := ReadInput(prompt, false)
+		if err != nil {
+			return err
+		}
+		share, err := ShareFromString(str)
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			continue
+		}
+		shares = append(shares, share)
+	}
+
+	key, err := ShamirCombine(shares)
+	if err != nil {
+		return err
+	}
+	db, err := LoadDatabaseWithRecoveryKey(cfg.DatabaseFilename, key)
+	if err != nil {
+		return err
+	}
+
+	password, err := ReadInput(fmt.Sprintf("Enter new password for %s: ", member), true)
+	if err != nil {
+		return err
+	}
+	if err := db.SetPassword(member, password); err != nil {
+		return err
+	}
+	if err := db.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Password for %s was changed\n", member)
+	return nil
+}
+
+func cmdVerify(cfg *Config, name, code string) error {
+	if code == "-" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		code = strings.TrimSpace(line)
+	}
+
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	clock, err := cfg.Clock(db)
+	if err != nil {
+		return err
+	}
+
+	// the entry is looked up again if another process changed the database
+	var drift int
+	err = db.Update(func() error {
+		entry, err := db.FindExact(name)
+		if err != nil {
+			return err
+		}
+		if drift, err = entry.Verify(code, clock(), cfg.Window); err != nil {
+			return rejected{err}
+		}
+		return nil
+	})
+	if _, ok := err.(rejected); ok {
+		fmt.Printf("Rejected: %v\n", logReason(err))
+		os.Exit(1)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Accepted (drift %d)\n", drift)
+	return nil
+}
+
+func cmdServe(cfg *Config) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	clock, err := cfg.Clock(db)
+	if err != nil {
+		return err
+	}
+	v := NewValidator(db, cfg.Window)
+	v.MaxFailures = cfg.MaxFailures
+	v.now = clock
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	return Serve(cfg.Listen, v, stop)
+}
+
+func cmdRadius(cfg *Config) error {
+	secret := os.Getenv("TOK_RADIUS_SECRET")
+	if secret == "" {
+		var err error
+		if secret, err = ReadInput("Please enter RADIUS shared secret: ", true); err != nil {
+			return err
+		}
+	}
+	if secret == "" {
+		return fmt.Errorf("RADIUS shared secret can't be empty")
+	}
+
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+	clock, err := cfg.Clock(db)
+	if err != nil {
+		return err
+	}
+	v := NewValidator(db, cfg.Window)
+	v.MaxFailures = cfg.MaxFailures
+	v.now = clock
+
+	conn, err := net.ListenPacket("udp", cfg.RadiusListen)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	log.Printf("RADIUS listening on %s\n", cfg.RadiusListen)
+	s := NewRadiusServer([]byte(secret), v)
+	s.AllowNoAuthenticator = cfg.RadiusNoMA
+	return s.Serve(conn)
+}
+
+func cmdOcra(cfg *Config, name, challenge string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	entries, err := db.Find(name)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 {
+		return fmt.Errorf("could not select unique item '%s'", name)
+	}
+	entry := entries[0]
+
+	suite, key, err := entry.Ocra()
+	if err != nil {
+		return err
+	}
+
+	in := OcraInput{
+		Counter:  uint64(entry.Counter),
+		Question: challenge,
+		Pin:      entry.Pin,
+		Session:  cfg.Session,
+	}
+	if cfg.Pin != "" {
+		in.Pin = cfg.Pin
+	}
+	if suite.PinHash != 0 && in.Pin == "" {
+		if in.Pin, err = ReadInput("Enter PIN: ", true); err != nil {
+			return err
+		}
+	}
+	if suite.TimeStep != 0 {
+		clock, err := cfg.Clock(db)
+		if err != nil {
+			return err
+		}
+		in.Time = clock()
+	}
+
+	response, err := suite.Compute(key, in)
+	if err != nil {
+		return err
+	}
+
+	// the counter is used once, the next response uses the next value
+	if suite.Counter {
+		entry.Counter++
+		if err := db.Save(); err != nil {
+			return err
+		}
+	}
+	fmt.Println(response)
+	return nil
+}
+
+func cmdClock(cfg *Config, params []string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	switch {
+	case len(params) == 0:
+		fmt.Printf("Stored clock offset: %v\n", db.ClockOffset)
+		return nil
+
+	case params[0] == "set" && len(params) == 2:
+		offset, err := time.ParseDuration(params[1])
+		if err != nil {
+			return fmt.Errorf("Invalid time offset '%s': %v", params[1], err)
+		}
+		db.ClockOffset = offset
+		if err := db.Save(); err != nil {
+			return err
+		}
+		fmt.Printf("Stored clock offset: %v\n", offset)
+		return nil
+
+	case params[0] == "check" && len(params) == 2:
+		clock, err := cfg.Clock(db)
+		if err != nil {
+			return err
+		}
+
+		var offset time.Duration
+		if ref := params[1]; strings.HasPrefix(ref, "http://") || strings.HasPrefix(ref, "https://") {
+			if offset, err = ClockOffsetFromHttp(ref, clock); err != nil {
+				return err
+			}
+		} else {
+			entries, err := db.Find(ref)
+			if err != nil {
+				return err
+			}
+			if len(entries) != 1 {
+				return fmt.Errorf("could not select unique item '%s'", ref)
+			}
+			g, err := entries[0].Generator()
+			if err != nil {
+				return err
+			}
+			if g.CounterBased() {
+				return fmt.Errorf("'%s' is counter-based, it can't be used to check the clock", entries[0].Name)
+			}
+			code, err := ReadInput("Enter the current code from a device with a correct clock: ", false)
+			if err != nil {
+				return err
+			}
+			if offset, err = ClockOffsetFromCode(g, strings.TrimSpace(code), clock()); err != nil {
+				return err
+			}
+			from, until := g.Validity(g.Counter(clock()))
+			fmt.Printf("Note: a single code only gives the offset to the nearest %v\n", until.Sub(from))
+		}
+
+		// the measured offset is relative to the clock we used, which may already be adjusted
+		total := clock().Sub(time.Now()).Round(time.Second) + offset
+		fmt.Printf("Your clock is off by %v compared to the reference\n", offset)
+		if offset != 0 {
+			fmt.Printf("Run 'clock set %v' to correct it\n", total)
+		}
+		return nil
+	}
+
+	usage()
+	os.Exit(20)
+	return nil
+}
+
+// showNextEntry shows the code, counter-based codes are marked as used before they are shown
+func showNextEntry(db *Database, clock Clock, tim int, entry *Entry) error {
+	g, err := entry.Generator()
+	if err != nil {
+		return err
+	}
+	if !g.CounterBased() {
+		return showEntry(clock, tim, entry)
+	}
+
+	entry.Counter++
+	if err := db.Save(); err != nil {
+		return err
+	}
+	shown := *entry
+	shown.Counter--
+	return showEntry(clock, tim, &shown)
+}
+
+// parseTime parses RFC 3339 times, or local times without a time zone
+func parseTime(str string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Invalid time '%s', use for example 2026-10-18T14:02:00Z", str)
+}
+
+func cmdSearch(cfg *Config, name string) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	matches, err := db.Search(name)
+	if err != nil {
+		return err
+	}
+	entries := make([]*Entry, len(matches))
+	for i, m := range matches {
+		entries[i] = m.Entry
+	}
+	// pick the best match if it is clearly better than the rest
+	if winner := clearWinner(matches); winner != nil {
+		entries = []*Entry{winner}
+	}
+
+	switch len(entries) {
+	case 0:
+		return fmt.Errorf("unable to find '%s'", name)
+	case 1:
+		clock, err := cfg.Clock(db)
+		if err != nil {
+			return err
+		}
+		if cfg.At == "" && cfg.Next == 0 && cfg.Prev == 0 {
+			return showNextEntry(db, clock, cfg.Time, entries[0])
+		}
+
+		at := clock()
+		if cfg.At != "" {
+			if at, err = parseTime(cfg.At); err != nil {
+				return err
+			}
+		}
+		if cfg.Next < 0 || cfg.Prev < 0 || cfg.Next+cfg.Prev > 1000 {
+			return fmt.Errorf("Invalid number of periods: -prev %d -next %d", cfg.Prev, cfg.Next)
+		}
+		return showCodes(entries[0], at, cfg.Prev, cfg.Next)
+	default:
+		showEntries(false, false, entries, db.Entries)
+		return fmt.Errorf("multiple items matching '%s'", name)
+	}
+}
+
+func cmdList(cfg *Config) error {
+	db, err := getDatabase(cfg, false)
+	if err != nil {
+		log.Fatalf("Internal error: %v\n", err)
+	}
+
+	entries := db.Entries
+	if cfg.Tag != "" || cfg.Folder != "" {
+		entries = nil
+		for _, e := range db.Entries {
+			if (cfg.Tag == "" || e.HasTag(cfg.Tag)) && e.InFolder(cfg.Folder) {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	if cfg.Tree {
+		showTree(entries)
+	} else {
+		showEntries(false, cfg.Verbose, entries, db.Entries)
+	}
+	return nil
+}
+
+func main() {
+	cfg, args := parseParams()
+	cmd, params := args[0], args[1:]
+
+	// check if we received the correct number of parameters
+	n := len(params)
+	if (cmd == "add" && n > 3) ||
+		(cmd == "new" && n != 1) ||
+		(cmd == "import" && n != 1) ||
+		(cmd == "export" && n != 1) ||
+		(cmd == "edit" && n != 1) ||
+		(cmd == "rm" && n != 1) ||
+		(cmd == "trash" && (n == 0 || n > 2)) ||
+		(cmd == "log" && n > 1) ||
+		(cmd == "merge" && n != 1) ||
+		(cmd == "convert" && n != 1) ||
+		(cmd == "tag" && n != 3) ||
+		(cmd == "mv" && n != 2) ||
+		(cmd == "keygen" && n != 0) ||
+		(cmd == "share" && n == 0) ||
+		(cmd == "receive" && n != 1) ||
+		((cmd == "members" || cmd == "slot") && (n == 0 || n > 3)) ||
+		(cmd == "recovery" && (n == 0 || n > 2)) ||
+		(cmd == "ls" && n != 0) ||
+		(cmd == "show" && n != 1) ||
+		(cmd == "verify" && n != 2) ||
+		(cmd == "serve" && n != 0) ||
+		(cmd == "radius" && n != 0) ||
+		(cmd == "clock" && n > 2) ||
+		(cmd == "ocra" && n != 2) {
+		usage()
+		os.Exit(20)
+	}
+
+	var err error
+	switch cmd {
+	case "add":
+		params = append(params, "", "", "") // make room for missing or optional parameters
+		name, secret, notes := params[0], params[1], params[2]
+		if n == 0 {
+			name, err = ReadInput("Enter name: ", false)
+		}
+		if err == nil && n < 2 {
+			secret, err = ReadInput("Enter secret: ", false)
+		}
+
+		if err == nil && n < 2 { // not 3, user name choose to not add a note
+			notes, err = ReadInput("Enter note: ", false)
+		}
+		if err == nil {
+			err = cmdAdd(cfg, name, secret, notes)
+		}
+	case "new":
+		err = cmdNew(cfg, params[0])
 	case "import":
 		err = cmdImport(cfg, params[0])
 	case "export":
 		err = cmdExport(cfg, params[0])
+	case "edit":
+		err = cmdEdit(cfg, params[0])
 	case "rm":
 		err = cmdRemove(cfg, params[0])
+	case "trash":
+		err = cmdTrash(cfg, params)
+	case "log":
+		err = cmdLog(cfg, params)
+	case "merge":
+		err = cmdMerge(cfg, params[0])
+	case "convert":
+		err = cmdConvert(cfg, params[0])
+	case "tag":
+		err = cmdTag(cfg, params[0], params[1], params[2])
+	case "mv":
+		err = cmdMove(cfg, params[0], params[1])
+	case "keygen":
+		err = cmdKeygen(cfg)
+	case "share":
+		err = cmdShare(cfg, params)
+	case "receive":
+		err = cmdReceive(cfg, params[0])
+	case "members", "slot":
+		err = cmdMembers(cfg, params)
+	case "recovery":
+		switch {
+		case params[0] == "split" && n == 1:
+			err = cmdRecoverySplit(cfg)
+		case params[0] == "unlock" && n == 1:
+			err = cmdRecoveryUnlock(cfg, DEFAULT_MEMBER)
+		case params[0] == "unlock":
+			err = cmdRecoveryUnlock(cfg, params[1])
+		default:
+			usage()
+			os.Exit(20)
+		}
 	case "ls":
 		err = cmdList(cfg)
 	case "show":
 		err = cmdSearch(cfg, params[0])
+	case "verify":
+		err = cmdVerify(cfg, params[0], params[1])
+	case "serve":
+		err = cmdServe(cfg)
+	case "radius":
+		err = cmdRadius(cfg)
+	case "clock":
+		err = cmdClock(cfg, params)
+	case "ocra":
+		err = cmdOcra(cfg, params[0], params[1])
 	default:
 		// also allow user to not use any command and just use the token name
 		err = cmdSearch(cfg, cmd)
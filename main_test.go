@@ -0,0 +1,26 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestInterspersedArgs(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"import", "-", "-dup", "rename"}, []string{"import", "-"}},
+		{[]string{"clock", "set", "-1m30s"}, []string{"clock", "set", "-1m30s"}},
+		{[]string{"clock", "set", "-42", "-dup", "skip"}, []string{"clock", "set", "-42"}},
+		{[]string{"verify", "-dup", "skip", "--", "-name", "123456"}, []string{"verify", "-name", "123456"}},
+	}
+	for _, test := range tests {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.String("dup", "", "")
+		if got := interspersedArgs(flags, test.args); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: expected %v got %v", test.args, test.want, got)
+		}
+	}
+}
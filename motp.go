@@ -0,0 +1,76 @@
+// Mobile-OTP, see http://motp.sourceforge.net
+//
+// The code is the first 6 hex digits of MD5(time/10 + secret + PIN), where the
+// time is in seconds and written in decimal, and the secret is the hex "init
+// secret" used as text.
+
+package main
+
+import (
+	"crypto"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	MOTP_PERIOD = 10
+	MOTP_DIGITS = 6
+)
+
+func init() {
+	RegisterGenerator(ENTRY_MOTP, GeneratorType{
+		Name: "mOTP",
+		New: func(e Entry) (Generator, error) {
+			return NewMotp(e.Secret, e.Pin)
+		},
+		Option:    "motp",
+		Period:    MOTP_PERIOD,
+		Digits:    MOTP_DIGITS,
+		Hash:      crypto.MD5,
+		PinInCode: true,
+	})
+}
+
+// Motp is a Mobile-OTP generator
+type Motp struct {
+	Secret string
+	Pin    string
+}
+
+// NewMotp creates a Mobile-OTP generator, the secret must be at least 16 hex digits
+func NewMotp(secret, pin string) (*Motp, error) {
+	if _, err := hex.DecodeString(secret); err != nil || len(secret) < 16 {
+		return nil, fmt.Errorf("Invalid mOTP secret, expected at least 16 hex digits")
+	}
+	if pin == "" {
+		return nil, fmt.Errorf("mOTP requires a PIN")
+	}
+	return &Motp{Secret: secret, Pin: pin}, nil
+}
+
+// Counter returns the time step at a time
+func (m Motp) Counter(at time.Time) int64 {
+	return at.Unix() / MOTP_PERIOD
+}
+
+// Validity returns the time span where the code for a counter is valid
+func (m Motp) Validity(counter int64) (time.Time, time.Time) {
+	return stepValidity(counter, MOTP_PERIOD)
+}
+
+func (m Motp) CounterBased() bool {
+	return false
+}
+
+func (m Motp) Hints() DisplayHints {
+	return groupHint(MOTP_DIGITS)
+}
+
+// Code returns the code for a counter
+func (m Motp) Code(counter int64) string {
+	sum := md5.Sum([]byte(strconv.FormatInt(counter, 10) + m.Secret + m.Pin))
+	return hex.EncodeToString(sum[:])[:MOTP_DIGITS]
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMotp(t *testing.T) {
+	// The codes were computed with md5sum instead of this code: the md5 of the
+	// decimal epoch/10, the secret and the PIN written together as text, and the
+	// first 6 hex digits of the sum. For 1234567890 the text is 123456789 +
+	// e3152afee62599c8 + 1234:
+	//   printf '%s' 123456789e3152afee62599c81234 | md5sum | cut -c1-6
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{0, "2c244b"},
+		{1234567890, "49c5b4"},
+		{1581064020, "b52fd1"},
+		{2000000009, "eb6eb2"},
+	}
+
+	m, err := NewMotp("e3152afee62599c8", "1234")
+	if err != nil {
+		t.Fatalf("Could not create mOTP: %v", err)
+	}
+	for _, test := range tests {
+		if _, code := GenerateCode(m, time.Unix(test.time, 0)); code != test.code {
+			t.Errorf("mOTP at %d: expected %s got %s", test.time, test.code, code)
+		}
+	}
+
+	if _, err := NewMotp("e3152afe", "1234"); err == nil {
+		t.Errorf("Short secret should fail")
+	}
+	if _, err := NewMotp("e3152afee62599c8", ""); err == nil {
+		t.Errorf("Missing PIN should fail")
+	}
+}
+
+func TestPinEntry(t *testing.T) {
+	entry, err := NewTypedEntry(ENTRY_MOTP, "legacy", "e3152afee62599c8", DEFAULT_HASH, "", "1234", DEFAULT_PERIOD, DEFAULT_DIGITS)
+	if err != nil {
+		t.Fatalf("Could not create entry: %v", err)
+	}
+	if entry.Period != MOTP_PERIOD || entry.Digits != MOTP_DIGITS {
+		t.Errorf("Unexpected entry %+v", entry)
+	}
+
+	// the PIN is part of the code, so logins use only the code
+	if _, err := verifyPassword(entry, "49c5b4", time.Unix(1234567890, 0), 0); err != nil {
+		t.Errorf("mOTP code was rejected: %v", err)
+	}
+	if _, err := verifyPassword(entry, "1234"+"49c5b4", time.Unix(1234567890, 0), 0); err == nil {
+		t.Errorf("PIN+code should be rejected for mOTP")
+	}
+
+	if _, err := NewTypedEntry(ENTRY_YANDEX, "yandex", "6SB2IKNM6OBZPAVBVTOHDKS4FA", DEFAULT_HASH, "", "", DEFAULT_PERIOD, DEFAULT_DIGITS); err == nil {
+		t.Errorf("Yandex entry without PIN should fail")
+	}
+
+	// TOTP entries keep the PIN apart, it precedes the code in logins
+	entry, err = NewTypedEntry(ENTRY_TOTP, "totp", "6SB2IKNM6OBZPAVBVTOHDKS4FA", DEFAULT_HASH, "", "1234", DEFAULT_PERIOD, DEFAULT_DIGITS)
+	if err != nil || entry.PinInCode() || entry.Pin != "1234" {
+		t.Errorf("TOTP entry with PIN: %+v (%v)", entry, err)
+	}
+}
@@ -0,0 +1,210 @@
+// OCRA challenge-response algorithm, see RFC 6287
+//
+// A suite such as "OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1" describes the hash, the
+// number of digits and the inputs: counter (C), challenge (Q), PIN hash (P),
+// session information (S) and timestamp (T). The response is HOTP-style
+// truncation of an HMAC over the suite and the inputs.
+
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OCRA_VERSION       = "OCRA-1"
+	OCRA_QUESTION_SIZE = 128
+)
+
+// OCRA responses need a challenge, so there is no generator for them
+func init() {
+	RegisterGenerator(ENTRY_OCRA, GeneratorType{
+		Name: "OCRA",
+		New: func(e Entry) (Generator, error) {
+			return nil, fmt.Errorf("'%s' is an OCRA entry, use 'ocra %s CHALLENGE'", e.Name, e.Name)
+		},
+	})
+}
+
+// OcraSuite is a parsed OCRA suite
+type OcraSuite struct {
+	Suite   string
+	Hash    crypto.Hash
+	Digits  int // 0 means no truncation
+	Counter bool
+
+	QuestionFormat byte // 'A' alphanumeric, 'N' numeric or 'H' hex
+	QuestionMin    int
+	QuestionMax    int
+
+	PinHash     crypto.Hash // 0 if no PIN is used
+	SessionSize int         // bytes of session information, 0 if not used
+	TimeStep    time.Duration
+}
+
+// OcraInput contains the inputs used by a suite, the others are ignored
+type OcraInput struct {
+	Counter  uint64
+	Question string
+	Pin      string
+	Session  string // hex encoded
+	Time     time.Time
+}
+
+// ParseOcraSuite parses and validates an OCRA suite
+func ParseOcraSuite(suite string) (*OcraSuite, error) {
+	parts := strings.Split(suite, ":")
+	if len(parts) != 3 || parts[0] != OCRA_VERSION {
+		return nil, fmt.Errorf("Invalid OCRA suite '%s'", suite)
+	}
+	s := &OcraSuite{Suite: suite}
+
+	// crypto function: HOTP-SHAx-t
+	fn := strings.Split(parts[1], "-")
+	if len(fn) != 3 || fn[0] != "HOTP" {
+		return nil, fmt.Errorf("Invalid OCRA crypto function '%s'", parts[1])
+	}
+	hash, err := hashFromName(fn[1])
+	if err != nil {
+		return nil, err
+	}
+	digits, err := strconv.Atoi(fn[2])
+	if err != nil || (digits != 0 && (digits < 4 || digits > 10)) {
+		return nil, fmt.Errorf("Invalid OCRA digits '%s'", fn[2])
+	}
+	s.Hash, s.Digits = hash, digits
+
+	// data input: [C]-QFxx-[PH|Snnn|TG], in that order
+	inputs := strings.Split(parts[2], "-")
+	if inputs[0] == "C" {
+		s.Counter = true
+		inputs = inputs[1:]
+	}
+	if len(inputs) == 0 || len(inputs[0]) != 4 || inputs[0][0] != 'Q' || !strings.ContainsRune("ANH", rune(inputs[0][1])) {
+		return nil, fmt.Errorf("Invalid OCRA challenge format in '%s'", suite)
+	}
+	s.QuestionFormat = inputs[0][1]
+	if s.QuestionMax, err = strconv.Atoi(inputs[0][2:]); err != nil || s.QuestionMax < 4 || s.QuestionMax > 64 {
+		return nil, fmt.Errorf("Invalid OCRA challenge length in '%s'", suite)
+	}
+	s.QuestionMin = 4
+
+	for _, input := range inputs[1:] {
+		switch {
+		case input == "":
+			return nil, fmt.Errorf("Invalid OCRA suite '%s'", suite)
+		case input[0] == 'P' && s.PinHash == 0 && s.SessionSize == 0 && s.TimeStep == 0:
+			if s.PinHash, err = hashFromName(input[1:]); err != nil {
+				return nil, err
+			}
+		case input[0] == 'S' && s.SessionSize == 0 && s.TimeStep == 0:
+			size, err := strconv.Atoi(input[1:])
+			if err != nil || len(input) != 4 || size < 1 || size > 512 {
+				return nil, fmt.Errorf("Invalid OCRA session information '%s'", input)
+			}
+			s.SessionSize = size
+		case input[0] == 'T' && s.TimeStep == 0 && len(input) >= 3:
+			n, err := strconv.Atoi(input[1 : len(input)-1])
+			unit := map[byte]time.Duration{'S': time.Second, 'M': time.Minute, 'H': time.Hour}[input[len(input)-1]]
+			if err != nil || n < 1 || unit == 0 {
+				return nil, fmt.Errorf("Invalid OCRA time step '%s'", input)
+			}
+			s.TimeStep = time.Duration(n) * unit
+		default:
+			return nil, fmt.Errorf("Invalid OCRA data input '%s'", input)
+		}
+	}
+	return s, nil
+}
+
+// question encodes the challenge as the 128 byte Q input
+func (s OcraSuite) question(q string) ([]byte, error) {
+	if len(q) < s.QuestionMin || len(q) > s.QuestionMax {
+		return nil, fmt.Errorf("Challenge must be %d to %d characters", s.QuestionMin, s.QuestionMax)
+	}
+
+	var str string
+	switch s.QuestionFormat {
+	case 'N':
+		n, ok := new(big.Int).SetString(q, 10)
+		if !ok || n.Sign() < 0 {
+			return nil, fmt.Errorf("Challenge must be numeric")
+		}
+		str = n.Text(16)
+	case 'H':
+		if _, err := hex.DecodeString(q + strings.Repeat("0", len(q)%2)); err != nil {
+			return nil, fmt.Errorf("Challenge must be hexadecimal")
+		}
+		str = q
+	case 'A':
+		str = hex.EncodeToString([]byte(q))
+	}
+
+	// the hex string is padded with zeros on the right
+	str += strings.Repeat("0", 2*OCRA_QUESTION_SIZE-len(str))
+	return hex.DecodeString(str)
+}
+
+// Compute calculates the response for the inputs
+func (s OcraSuite) Compute(key []byte, in OcraInput) (string, error) {
+	msg := append([]byte(s.Suite), 0)
+
+	if s.Counter {
+		msg = binary.BigEndian.AppendUint64(msg, in.Counter)
+	}
+
+	q, err := s.question(in.Question)
+	if err != nil {
+		return "", err
+	}
+	msg = append(msg, q...)
+
+	if s.PinHash != 0 {
+		if in.Pin == "" {
+			return "", fmt.Errorf("Suite requires a PIN")
+		}
+		h := s.PinHash.New()
+		h.Write([]byte(in.Pin))
+		msg = h.Sum(msg)
+	}
+
+	if s.SessionSize != 0 {
+		session, err := hex.DecodeString(in.Session)
+		if err != nil || len(session) > s.SessionSize {
+			return "", fmt.Errorf("Session information must be at most %d hex encoded bytes", s.SessionSize)
+		}
+		msg = append(msg, make([]byte, s.SessionSize-len(session))...) // padded on the left
+		msg = append(msg, session...)
+	}
+
+	if s.TimeStep != 0 {
+		msg = binary.BigEndian.AppendUint64(msg, uint64(in.Time.Unix()/int64(s.TimeStep/time.Second)))
+	}
+
+	mac := hmac.New(s.Hash.New, key)
+	mac.Write(msg)
+	hash := mac.Sum(nil)
+	if s.Digits == 0 {
+		return hex.EncodeToString(hash), nil
+	}
+
+	code := uint64(dynamicTruncate(hash)) % pow10(s.Digits)
+	return fmt.Sprintf("%0*d", s.Digits, code), nil
+}
+
+// helper to compute 10^n for up to 10 digits
+func pow10(n int) uint64 {
+	ret := uint64(1)
+	for i := 0; i < n; i++ {
+		ret *= 10
+	}
+	return ret
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestOcra(t *testing.T) {
+	// test vectors from RFC 6287 appendix C
+	const KEY20 = "12345678901234567890"
+	const KEY32 = KEY20 + "123456789012"
+	const KEY64 = KEY20 + KEY20 + KEY20 + "1234"
+	timestamp := time.Unix(0x132d0b6*60, 0) // Mar 25 2008, 12:06:30 GMT
+
+	tests := []struct {
+		suite    string
+		key      string
+		input    OcraInput
+		response string
+	}{
+		{"OCRA-1:HOTP-SHA1-6:QN08", KEY20, OcraInput{Question: "00000000"}, "237653"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", KEY20, OcraInput{Question: "11111111"}, "243178"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", KEY20, OcraInput{Question: "55555555"}, "388898"},
+		{"OCRA-1:HOTP-SHA1-6:QN08", KEY20, OcraInput{Question: "99999999"}, "294470"},
+
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", KEY32, OcraInput{Counter: 0, Question: "12345678", Pin: "1234"}, "65347737"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", KEY32, OcraInput{Counter: 1, Question: "12345678", Pin: "1234"}, "86775851"},
+		{"OCRA-1:HOTP-SHA256-8:C-QN08-PSHA1", KEY32, OcraInput{Counter: 9, Question: "12345678", Pin: "1234"}, "08522129"},
+
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", KEY64, OcraInput{Question: "00000000", Time: timestamp}, "95209754"},
+		{"OCRA-1:HOTP-SHA512-8:QN08-T1M", KEY64, OcraInput{Question: "44444444", Time: timestamp}, "36209546"},
+
+		{"OCRA-1:HOTP-SHA256-8:QA08", KEY32, OcraInput{Question: "SIG10000"}, "53095496"},
+		{"OCRA-1:HOTP-SHA256-8:QA08", KEY32, OcraInput{Question: "SIG14000"}, "46554205"},
+	}
+
+	for _, test := range tests {
+		suite, err := ParseOcraSuite(test.suite)
+		if err != nil {
+			t.Errorf("%s: %v", test.suite, err)
+			continue
+		}
+		got, err := suite.Compute([]byte(test.key), test.input)
+		if err != nil || got != test.response {
+			t.Errorf("%s %+v: expected %s got %s (%v)", test.suite, test.input, test.response, got, err)
+		}
+	}
+}
+
+func TestOcraSuite(t *testing.T) {
+	suite, err := ParseOcraSuite("OCRA-1:HOTP-SHA512-8:C-QH40-PSHA256-S064-T30S")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	expected := OcraSuite{
+		Suite:          "OCRA-1:HOTP-SHA512-8:C-QH40-PSHA256-S064-T30S",
+		Hash:           suite.Hash,
+		Digits:         8,
+		Counter:        true,
+		QuestionFormat: 'H',
+		QuestionMin:    4,
+		QuestionMax:    40,
+		PinHash:        suite.PinHash,
+		SessionSize:    64,
+		TimeStep:       30 * time.Second,
+	}
+	if *suite != expected || fmt.Sprint(suite.Hash, suite.PinHash) != "SHA-512 SHA-256" {
+		t.Errorf("Unexpected suite %+v", suite)
+	}
+
+	for _, bad := range []string{
+		"OCRA-2:HOTP-SHA1-6:QN08",
+		"OCRA-1:HOTP-MD5-6:QN08",
+		"OCRA-1:HOTP-SHA1-3:QN08",
+		"OCRA-1:HOTP-SHA1-6:C",
+		"OCRA-1:HOTP-SHA1-6:QX08",
+		"OCRA-1:HOTP-SHA1-6:QN65",
+		"OCRA-1:HOTP-SHA1-6:QN08-T1M-PSHA1",
+		"OCRA-1:HOTP-SHA1-6:QN08-T1D",
+		"OCRA-1:HOTP-SHA1-6:QN08-",
+	} {
+		if _, err := ParseOcraSuite(bad); err == nil {
+			t.Errorf("Suite '%s' should be invalid", bad)
+		}
+	}
+
+	// challenges must match the format
+	suite = ensure(ParseOcraSuite("OCRA-1:HOTP-SHA1-6:QN08"))
+	for _, q := range []string{"123", "123456789", "1234abcd"} {
+		if _, err := suite.Compute([]byte("12345678901234567890"), OcraInput{Question: q}); err == nil {
+			t.Errorf("Challenge '%s' should be invalid", q)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 )
 
 // EntryFromUri extracts an entry from a otpauth string
@@ -15,28 +16,104 @@ func EntryFromUri(uristr string) (*Entry, error) {
 	if err != nil {
 		return nil, err
 	}
-	if !(uri.Scheme == "otpauth" || uri.Scheme == "apple-otpauth") || uri.Host != "totp" {
+	if !(uri.Scheme == "otpauth" || uri.Scheme == "apple-otpauth") {
 		return nil, fmt.Errorf("expected otpauth://totp/...")
 	}
 
+	// find the entry type, Steam codes are marked with encoder=steam
 	query := uri.Query()
-	digits, err := strconv.ParseInt(query.Get("digits"), 10, 8)
+	entryType, found := "", false
+	var t GeneratorType
+	for name, typ := range generatorTypes {
+		if typ.UriType != "" && typ.UriType == uri.Host && typ.UriEncoder == query.Get("encoder") {
+			entryType, t, found = name, typ, true
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("unsupported otpauth type '%s' (encoder '%s')", uri.Host, query.Get("encoder"))
+	}
+
+	// some apps leave out the parameters
+	defaultDigits, defaultPeriod := DEFAULT_DIGITS, DEFAULT_PERIOD
+	if t.Digits != 0 {
+		defaultDigits = t.Digits
+	}
+	if t.Period != 0 {
+		defaultPeriod = t.Period
+	}
+
+	digits, err := uriParameter(query, "digits", defaultDigits)
+	if err != nil {
+		return nil, err
+	}
+
+	period, err := uriParameter(query, "period", defaultPeriod)
 	if err != nil {
 		return nil, err
 	}
 
-	period, err := strconv.ParseInt(query.Get("period"), 10, 8)
+	algorithm := query.Get("algorithm")
+	if algorithm == "" {
+		algorithm = DEFAULT_HASH
+	}
+
+	name := strings.TrimPrefix(uri.Path, "/")
+	if name == "" {
+		return nil, fmt.Errorf("otpauth URI has no name")
+	}
+
+	entry, err := NewEntry(name, query.Get("secret"), algorithm, "", period, digits)
 	if err != nil {
 		return nil, err
 	}
+	entry.Issuer = query.Get("issuer")
+	entry.Type = entryType
 
-	return NewEntry(uri.Path[1:], query.Get("secret"), query.Get("algorithm"), "", int(period), int(digits))
+	if t.UriCounter {
+		counter, err := uriParameter(query, "counter", 0)
+		if err != nil {
+			return nil, err
+		}
+		entry.Counter = int64(counter)
+	}
+	return entry, nil
+}
+
+// uriParameter returns a numeric parameter, or the default value if it is missing
+func uriParameter(query url.Values, name string, def int) (int, error) {
+	if !query.Has(name) {
+		return def, nil
+	}
+	val, err := strconv.ParseInt(query.Get(name), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return int(val), nil
 }
 
 // EntryToUri generates the otpauth string for this entry
 func EntryToUri(e *Entry) (string, error) {
-	return fmt.Sprintf("otpauth://totp/%s?secret=%s&issuer=issuer&algorithm=%s&digits=%d&period=%d",
-		url.PathEscape(e.Name), e.Secret,
-		hashToName(e.Hash), e.Digits, e.Period,
+	t, err := generatorType(e.Type)
+	if err != nil {
+		return "", err
+	}
+	if t.UriType == "" {
+		return "", fmt.Errorf("%s entry '%s' has no otpauth URI", t.Name, e.Name)
+	}
+
+	issuer := ""
+	if e.Issuer != "" {
+		issuer = "&issuer=" + url.QueryEscape(e.Issuer)
+	}
+	extra := fmt.Sprintf("&period=%d", e.Period)
+	if t.UriCounter {
+		extra = fmt.Sprintf("&counter=%d", e.Counter)
+	}
+	if t.UriEncoder != "" {
+		extra += "&encoder=" + t.UriEncoder
+	}
+	return fmt.Sprintf("otpauth://%s/%s?secret=%s%s&algorithm=%s&digits=%d%s",
+		t.UriType, url.PathEscape(e.Name), e.Secret, issuer,
+		hashToName(e.Hash), e.Digits, extra,
 	), nil
 }
@@ -9,6 +9,7 @@ func TestImportExport(t *testing.T) {
 	tests := []struct {
 		uri    string
 		name   string
+		issuer string
 		secret string
 		hash   crypto.Hash
 		digits uint8
@@ -18,6 +19,7 @@ func TestImportExport(t *testing.T) {
 			// test case from Google
 			"otpauth://totp/ACME%20Co:john.doe@email.com?secret=HXDMVJECJJWSRB3HWIZR4IFUGFTMXBOZ&issuer=ACME%20Co&algorithm=SHA1&digits=6&period=30",
 			"ACME Co:john.doe@email.com",
+			"ACME Co",
 			"HXDMVJECJJWSRB3HWIZR4IFUGFTMXBOZ",
 			crypto.SHA1,
 			6,
@@ -33,6 +35,9 @@ func TestImportExport(t *testing.T) {
 			if test.name != e.Name {
 				t.Errorf("expected name '%v' got '%v'", test.name, e.Name)
 			}
+			if test.issuer != e.Issuer {
+				t.Errorf("expected issuer '%v' got '%v'", test.issuer, e.Issuer)
+			}
 			if test.secret != e.Secret {
 				t.Errorf("expected secret '%v' got '%v'", test.secret, e.Secret)
 			}
@@ -52,6 +57,9 @@ func TestImportExport(t *testing.T) {
 				if e.Name != e2.Name {
 					t.Errorf("expected recoded name '%v' got '%v'", e.Name, e2.Name)
 				}
+				if e.Issuer != e2.Issuer {
+					t.Errorf("expected recoded issuer '%v' got '%v'", e.Issuer, e2.Issuer)
+				}
 				if e.Secret != e2.Secret {
 					t.Errorf("expected recoded secret '%v' got '%v'", e.Secret, e2.Secret)
 				}
@@ -68,3 +76,11 @@ func TestImportExport(t *testing.T) {
 	}
 
 }
+
+func TestUriWithoutName(t *testing.T) {
+	for _, uri := range []string{"otpauth://totp?secret=ABC", "otpauth://totp/?secret=ABC"} {
+		if _, err := EntryFromUri(uri); err == nil {
+			t.Errorf("URI without a name was accepted: %s", uri)
+		}
+	}
+}
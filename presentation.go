@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"sort"
 	"strings"
 	"time"
 )
@@ -29,14 +30,21 @@ func TextControl(code int) string {
 	return fmt.Sprintf("\033[%dm", code)
 }
 
-// codeWithProgress creates a progress bar with the kod
-func codeWithProgress(kod string, curr, max int) string {
-	// add some space in the middle and make it a bit prettier...
-	if len(kod) > 4 {
-		mid := len(kod) / 2
-		kod = fmt.Sprintf("%s %s", kod[:mid], kod[mid:])
+// groupCode adds some space between groups of characters to make the code a bit prettier...
+func groupCode(kod string, hints DisplayHints) string {
+	if hints.Group == 0 {
+		return kod
 	}
+	var groups []string
+	for len(kod) > hints.Group {
+		groups = append(groups, kod[:hints.Group])
+		kod = kod[hints.Group:]
+	}
+	return strings.Join(append(groups, kod), " ")
+}
 
+// codeWithProgress creates a progress bar with the kod
+func codeWithProgress(kod string, curr, max int) string {
 	color := TERM_BG + TERM_GREEN
 	if curr*8 > max*7 {
 		color = TERM_BG + TERM_RED
@@ -56,8 +64,8 @@ func codeWithProgress(kod string, curr, max int) string {
 }
 
 // showEntry will try to show the token in a somewhat readable way
-func showEntry(tim int, entry *Entry) error {
-	totp, err := entry.Totp()
+func showEntry(clock Clock, tim int, entry *Entry) error {
+	g, err := entry.Generator()
 	if err != nil {
 		return err
 	}
@@ -69,10 +77,20 @@ func showEntry(tim int, entry *Entry) error {
 	}
 	fmt.Println()
 
+	// counter-based codes don't expire
+	if g.CounterBased() {
+		counter := g.Counter(clock())
+		fmt.Printf(" [counter %d] - %s\n", counter, groupCode(g.Code(counter), g.Hints()))
+		return nil
+	}
+
 	var line string
 	for i := 0; i < tim; i++ {
-		timeleft, kod := totp.Generate()
-		line = codeWithProgress(kod, int(totp.Period)-timeleft, int(totp.Period))
+		now := clock()
+		from, until := g.Validity(g.Counter(now))
+		period := int(until.Sub(from) / time.Second)
+		timeleft, kod := GenerateCode(g, now)
+		line = codeWithProgress(groupCode(kod, g.Hints()), period-timeleft, period)
 		fmt.Printf("%s \r", line)
 		time.Sleep(time.Second)
 	}
@@ -83,21 +101,75 @@ func showEntry(tim int, entry *Entry) error {
 	return nil
 }
 
-// showEntries lists a set of entries but does not show the token
-func showEntries(asuri, verbose bool, entries []*Entry) {
-	for i, entry := range entries {
+// showCodes lists the codes for the time steps around a time with their validity,
+// without waiting for them. The step containing the time is marked
+func showCodes(entry *Entry, at time.Time, prev, next int) error {
+	g, err := entry.Generator()
+	if err != nil {
+		return err
+	}
+
+	const LAYOUT = "2006-01-02 15:04:05"
+	fmt.Printf("Token '%s' at %s:\n", entry.Name, at.Format(LAYOUT+" MST"))
+
+	counter := g.Counter(at)
+	for c := counter - int64(prev); c <= counter+int64(next); c++ {
+		from, until := g.Validity(c)
+		kod := groupCode(g.Code(c), g.Hints())
+		mark := " "
+		if c == counter {
+			mark = ">"
+		}
+		if g.CounterBased() {
+			if c >= 0 {
+				fmt.Printf("%s %12d  %s\n", mark, c, kod)
+			}
+			continue
+		}
+		fmt.Printf("%s %12d  %s - %s  %s\n", mark, c,
+			from.In(at.Location()).Format(LAYOUT), until.In(at.Location()).Format("15:04:05"), kod)
+	}
+	return nil
+}
+
+// showEntries lists a set of entries but does not show the token. The entries are
+// numbered by their position in all, so that the number works with #N. Entries that
+// have no URI are skipped with a warning, the entries that were shown are returned
+func showEntries(asuri, verbose bool, entries, all []*Entry) []*Entry {
+	var shown []*Entry
+	for _, entry := range entries {
+		i := 0
+		for i < len(all) && all[i] != entry {
+			i++
+		}
 		if asuri {
 			str, err := EntryToUri(entry)
 			if err != nil {
-				log.Fatalf("Unable to convert entry to uri: '%v'", err)
+				log.Printf("Warning: skipping %v\n", err)
+				continue
 			}
 			fmt.Printf("%3d - %s\n", i+1, str)
 
 		} else if verbose {
 			fmt.Printf("%3d - %s\n", i+1, entry.Name)
+			fmt.Printf("\tId: %s\n", entry.Id)
 			if entry.Note != "" {
 				fmt.Printf("\tNote: %s\n", entry.Note)
 			}
+			if entry.Issuer != "" {
+				fmt.Printf("\tIssuer: %s\n", entry.Issuer)
+			}
+			if t, err := generatorType(entry.Type); err != nil {
+				fmt.Printf("\tType: %s (unknown)\n", entry.Type)
+			} else {
+				fmt.Printf("\tType: %s\n", strings.TrimSpace(t.Name+" "+entry.Suite))
+			}
+			if entry.Folder != "" {
+				fmt.Printf("\tFolder: %s\n", entry.Folder)
+			}
+			if len(entry.Tags) != 0 {
+				fmt.Printf("\tTags: %s\n", strings.Join(entry.Tags, ", "))
+			}
 			fmt.Printf("\tDate added: %s\n", entry.Date())
 			fmt.Printf("\tPeriod: %d\n", entry.Period)
 			fmt.Printf("\tDigits: %d\n", entry.Digits)
@@ -106,5 +178,112 @@ func showEntries(asuri, verbose bool, entries []*Entry) {
 		} else {
 			fmt.Printf("%3d - %s\n", i+1, entry.Name)
 		}
+		shown = append(shown, entry)
+	}
+	return shown
+}
+
+// showTree lists the entries grouped by folder, folders are sorted but
+// the entries in a folder keep their order
+func showTree(entries []*Entry) {
+	var folders []string
+	byFolder := make(map[string][]*Entry)
+	for _, e := range entries {
+		if _, found := byFolder[e.Folder]; !found {
+			folders = append(folders, e.Folder)
+		}
+		byFolder[e.Folder] = append(byFolder[e.Folder], e)
+	}
+	// sort by path components, so that "work/aws" comes right after "work"
+	sort.Slice(folders, func(i, j int) bool {
+		return strings.ReplaceAll(folders[i], "/", "\x00") < strings.ReplaceAll(folders[j], "/", "\x00")
+	})
+
+	var shown []string // the path of the folder shown last
+	for _, folder := range folders {
+		var parts []string
+		if folder != "" {
+			parts = strings.Split(folder, "/")
+		}
+		// only show the parts that differ from the previous folder
+		common := 0
+		for common < len(parts) && common < len(shown) && parts[common] == shown[common] {
+			common++
+		}
+		for i := common; i < len(parts); i++ {
+			fmt.Printf("%s%s/\n", strings.Repeat("    ", i), parts[i])
+		}
+		shown = parts
+
+		indent := strings.Repeat("    ", len(parts))
+		for _, e := range byFolder[folder] {
+			tags := ""
+			if len(e.Tags) != 0 {
+				tags = " [" + strings.Join(e.Tags, ", ") + "]"
+			}
+			fmt.Printf("%s%s%s\n", indent, e.Name, tags)
+		}
+	}
+}
+
+// showTrash lists removed entries with the time they will be purged
+func showTrash(items []*TrashItem, days uint32) {
+	for i, item := range items {
+		fmt.Printf("%3d - %s, removed %s", i+1, item.Entry.Name, item.Date())
+		if expires := item.Expires(days); !expires.IsZero() {
+			fmt.Printf(", purged after %s", expires.Format("2006-01-02"))
+		}
+		fmt.Println()
+	}
+}
+
+// showJournal lists journal records, oldest first
+func showJournal(records []*JournalRecord) {
+	for _, r := range records {
+		id := r.EntryId
+		if len(id) > 8 {
+			id = id[:8]
+		}
+		fmt.Printf("%s  %-8s %s (@%s) by %s@%s\n", r.Date(), r.Op, r.Name, id, r.User, r.Host)
+	}
+}
+
+// showQr shows an otpauth URI as text and as a QR code
+func showQr(uri string) error {
+	qr, err := NewQrCode([]byte(uri))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n\n%s\n", uri, qr)
+	return nil
+}
+
+// showImportResults prints a summary of an import
+func showImportResults(results []ImportResult) {
+	added, skipped, failed := 0, 0, 0
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Printf("%4d: %s\n", r.Line, r.Err)
+			continue
+		case strings.HasPrefix(r.Status, "skipped"):
+			skipped++
+		default:
+			added++
+		}
+		fmt.Printf("%4d: '%s' %s\n", r.Line, r.Name, r.Status)
+	}
+	fmt.Printf("%d added, %d skipped, %d failed\n", added, skipped, failed)
+}
+
+// showSlots lists the key slots, marking the one that was used to open the database
+func showSlots(slots []*KeySlot, current *KeySlot) {
+	for i, slot := range slots {
+		mark := " "
+		if slot == current {
+			mark = "*"
+		}
+		fmt.Printf("%3d %s %s (%s)\n", i+1, mark, slot.Name, slot.Kind())
 	}
 }
@@ -0,0 +1,479 @@
+// Minimal QR code encoder (ISO/IEC 18004), so we can show otpauth URIs without an external package.
+//
+// Only byte mode and error correction level M are supported, with versions 1 to 20.
+// That is enough for URIs up to 666 bytes.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	QR_MAX_VERSION = 20
+	QR_ECL_M       = 0 // format bits for error correction level M
+)
+
+// qrBlocks describes the error correction blocks for one version at level M:
+// ec codewords per block, number of blocks and data codewords in group 1 and group 2
+type qrBlocks struct {
+	ec, n1, d1, n2, d2 int
+}
+
+var qrLevelM = [QR_MAX_VERSION + 1]qrBlocks{
+	{},
+	{10, 1, 16, 0, 0}, {16, 1, 28, 0, 0}, {26, 1, 44, 0, 0}, {18, 2, 32, 0, 0}, {24, 2, 43, 0, 0},
+	{16, 4, 27, 0, 0}, {18, 4, 31, 0, 0}, {22, 2, 38, 2, 39}, {22, 3, 36, 2, 37}, {26, 4, 43, 1, 44},
+	{30, 1, 50, 4, 51}, {22, 6, 36, 2, 37}, {22, 8, 37, 1, 38}, {24, 4, 40, 5, 41}, {24, 5, 41, 5, 42},
+	{28, 7, 45, 3, 46}, {28, 10, 46, 1, 47}, {26, 9, 43, 4, 44}, {26, 3, 44, 11, 45}, {26, 3, 41, 13, 42},
+}
+
+func (b qrBlocks) dataSize() int {
+	return b.n1*b.d1 + b.n2*b.d2
+}
+
+// QrCode is a square matrix of modules, true is dark
+type QrCode struct {
+	Size    int
+	Modules [][]bool
+	// function marks modules that are part of fixed patterns and can't hold data
+	function [][]bool
+}
+
+// NewQrCode encodes the data in the smallest version that fits
+func NewQrCode(data []byte) (*QrCode, error) {
+	version := 1
+	for ; version <= QR_MAX_VERSION; version++ {
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) <= 8*qrLevelM[version].dataSize() {
+			break
+		}
+	}
+	if version > QR_MAX_VERSION {
+		return nil, fmt.Errorf("Too much data for a QR code: %d bytes", len(data))
+	}
+
+	codewords := qrAddEcc(qrEncodeData(data, version), version)
+
+	// try all masks and keep the one with the lowest penalty
+	var best *QrCode
+	bestPenalty := 0
+	for mask := 0; mask < 8; mask++ {
+		qr := newQrCodeWithMask(codewords, version, mask)
+		if penalty := qr.penalty(); best == nil || penalty < bestPenalty {
+			best, bestPenalty = qr, penalty
+		}
+	}
+	return best, nil
+}
+
+// newQrCodeWithMask draws the codewords in a given version and mask
+func newQrCodeWithMask(codewords []byte, version, mask int) *QrCode {
+	qr := newQrMatrix(version)
+	qr.drawCodewords(codewords)
+	qr.applyMask(mask)
+	qr.drawFormat(mask)
+	return qr
+}
+
+// qrEncodeData creates the data codewords: mode, length, data, terminator and padding
+func qrEncodeData(data []byte, version int) []byte {
+	var bits []bool
+	put := func(val, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, (val>>i)&1 == 1)
+		}
+	}
+
+	countBits := 8
+	if version >= 10 {
+		countBits = 16
+	}
+	put(0b0100, 4) // byte mode
+	put(len(data), countBits)
+	for _, b := range data {
+		put(int(b), 8)
+	}
+
+	capacity := 8 * qrLevelM[version].dataSize()
+	for i := 0; i < 4 && len(bits) < capacity; i++ {
+		bits = append(bits, false)
+	}
+	for len(bits)%8 != 0 {
+		bits = append(bits, false)
+	}
+
+	var ret []byte
+	for i := 0; i < len(bits); i += 8 {
+		var b byte
+		for j := 0; j < 8; j++ {
+			if bits[i+j] {
+				b |= 0x80 >> j
+			}
+		}
+		ret = append(ret, b)
+	}
+	for pad := byte(0xEC); len(ret) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		ret = append(ret, pad)
+	}
+	return ret
+}
+
+// qrMul multiplies in GF(256) with the QR polynomial x^8+x^4+x^3+x^2+1
+func qrMul(a, b byte) byte {
+	var p byte
+	for b != 0 {
+		if b&1 != 0 {
+			p ^= a
+		}
+		hi := a & 0x80
+		a <<= 1
+		if hi != 0 {
+			a ^= 0x1d
+		}
+		b >>= 1
+	}
+	return p
+}
+
+// qrReedSolomon computes the n error correction codewords for the data
+func qrReedSolomon(data []byte, n int) []byte {
+	// generator polynomial (x - 2^0)(x - 2^1)...(x - 2^(n-1)), highest coefficient (1) is implied
+	gen := make([]byte, n)
+	gen[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			gen[j] = qrMul(gen[j], root)
+			if j+1 < n {
+				gen[j] ^= gen[j+1]
+			}
+		}
+		root = qrMul(root, 2)
+	}
+
+	// polynomial division, the remainder is the error correction
+	ecc := make([]byte, n)
+	for _, b := range data {
+		factor := b ^ ecc[0]
+		copy(ecc, ecc[1:])
+		ecc[n-1] = 0
+		for j := 0; j < n; j++ {
+			ecc[j] ^= qrMul(gen[j], factor)
+		}
+	}
+	return ecc
+}
+
+// qrAddEcc splits data in blocks, adds error correction and interleaves everything
+func qrAddEcc(data []byte, version int) []byte {
+	b := qrLevelM[version]
+	var blocks, eccs [][]byte
+	for i := 0; i < b.n1+b.n2; i++ {
+		size := b.d1
+		if i >= b.n1 {
+			size = b.d2
+		}
+		blocks = append(blocks, data[:size])
+		eccs = append(eccs, qrReedSolomon(data[:size], b.ec))
+		data = data[size:]
+	}
+
+	var ret []byte
+	for i := 0; i < b.d2 || i < b.d1; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				ret = append(ret, block[i])
+			}
+		}
+	}
+	for i := 0; i < b.ec; i++ {
+		for _, ecc := range eccs {
+			ret = append(ret, ecc[i])
+		}
+	}
+	return ret
+}
+
+// qrAlignment returns the center coordinates of alignment patterns
+func qrAlignment(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	size := version*4 + 17
+	step := (version*4 + n*2 + 1) / (n*2 - 2) * 2
+	ret := make([]int, n)
+	ret[0] = 6
+	for i, pos := n-1, size-7; i >= 1; i, pos = i-1, pos-step {
+		ret[i] = pos
+	}
+	return ret
+}
+
+// qrBCH computes the BCH error correction for format and version information
+func qrBCH(val, bits, poly int) int {
+	rem := val << (bits - 1)
+	for i := 2*bits - 2; i >= bits-1; i-- {
+		if (rem>>i)&1 != 0 {
+			rem ^= poly << (i - bits + 1)
+		}
+	}
+	return val<<(bits-1) | rem
+}
+
+// newQrMatrix creates an empty matrix with all function patterns drawn
+func newQrMatrix(version int) *QrCode {
+	size := version*4 + 17
+	qr := &QrCode{Size: size}
+	for i := 0; i < size; i++ {
+		qr.Modules = append(qr.Modules, make([]bool, size))
+		qr.function = append(qr.function, make([]bool, size))
+	}
+
+	// timing patterns
+	for i := 0; i < size; i++ {
+		qr.set(6, i, i%2 == 0)
+		qr.set(i, 6, i%2 == 0)
+	}
+
+	// finder patterns with separators
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := chebyshev(dx, dy)
+					qr.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+
+	// alignment patterns, except where they overlap the finders
+	pos := qrAlignment(version)
+	for i, x := range pos {
+		for j, y := range pos {
+			if (i == 0 && j == 0) || (i == 0 && j == len(pos)-1) || (i == len(pos)-1 && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.set(x+dx, y+dy, chebyshev(dx, dy) != 1)
+				}
+			}
+		}
+	}
+
+	// reserve format information, drawn later, and the dark module
+	qr.drawFormat(0)
+
+	// version information
+	if version >= 7 {
+		bits := qrBCH(version, 13, 0x1f25)
+		for i := 0; i < 18; i++ {
+			dark := (bits>>i)&1 != 0
+			a, b := size-11+i%3, i/3
+			qr.set(a, b, dark)
+			qr.set(b, a, dark)
+		}
+	}
+	return qr
+}
+
+// set draws a function module
+func (qr *QrCode) set(x, y int, dark bool) {
+	qr.Modules[y][x] = dark
+	qr.function[y][x] = true
+}
+
+// drawFormat draws the two copies of the format information
+func (qr *QrCode) drawFormat(mask int) {
+	bits := qrBCH(QR_ECL_M<<3|mask, 11, 0x537) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	// first copy, around the top left finder
+	for i := 0; i <= 5; i++ {
+		qr.set(8, i, bit(i))
+	}
+	qr.set(8, 7, bit(6))
+	qr.set(8, 8, bit(7))
+	qr.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.set(14-i, 8, bit(i))
+	}
+
+	// second copy, split between the other two finders
+	for i := 0; i < 8; i++ {
+		qr.set(qr.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.set(8, qr.Size-15+i, bit(i))
+	}
+	qr.set(8, qr.Size-8, true) // the dark module
+}
+
+// drawCodewords places the bits in the zigzag pattern, starting in the bottom right corner
+func (qr *QrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := qr.Size - 1; right >= 1; right -= 2 {
+		if right == 6 { // skip the vertical timing pattern
+			right = 5
+		}
+		for vert := 0; vert < qr.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 { // going up
+					y = qr.Size - 1 - vert
+				}
+				if !qr.function[y][x] && i < len(data)*8 {
+					qr.Modules[y][x] = (data[i>>3]>>(7-i&7))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts data modules according to the mask pattern
+func (qr *QrCode) applyMask(mask int) {
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !qr.function[y][x] {
+				qr.Modules[y][x] = !qr.Modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores the matrix according to the four rules in the standard, lower is better
+func (qr *QrCode) penalty() int {
+	penalty := 0
+	get := func(x, y int, transpose bool) bool {
+		if transpose {
+			return qr.Modules[x][y]
+		}
+		return qr.Modules[y][x]
+	}
+
+	for _, transpose := range []bool{false, true} {
+		for y := 0; y < qr.Size; y++ {
+			// rule 1: runs of five or more modules of the same color
+			run := 1
+			for x := 1; x < qr.Size; x++ {
+				if get(x, y, transpose) == get(x-1, y, transpose) {
+					run++
+					if run == 5 {
+						penalty += 3
+					} else if run > 5 {
+						penalty++
+					}
+				} else {
+					run = 1
+				}
+			}
+
+			// rule 3: patterns looking like finders, 1:1:3:1:1 with four light modules on one side
+			for x := 0; x+11 <= qr.Size; x++ {
+				var pattern [11]bool
+				for i := range pattern {
+					pattern[i] = get(x+i, y, transpose)
+				}
+				if pattern == [11]bool{true, false, true, true, true, false, true, false, false, false, false} ||
+					pattern == [11]bool{false, false, false, false, true, false, true, true, true, false, true} {
+					penalty += 40
+				}
+			}
+		}
+	}
+
+	// rule 2: 2x2 blocks of the same color
+	dark := 0
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			if qr.Modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := qr.Modules[y][x]
+				if c == qr.Modules[y-1][x] && c == qr.Modules[y][x-1] && c == qr.Modules[y-1][x-1] {
+					penalty += 3
+				}
+			}
+		}
+	}
+
+	// rule 4: balance between dark and light modules
+	percent := dark * 100 / (qr.Size * qr.Size)
+	penalty += abs(percent-50) / 5 * 10
+	return penalty
+}
+
+// String renders the code for a terminal, two rows per line using half blocks
+func (qr *QrCode) String() string {
+	const QUIET = 2
+	dark := func(x, y int) bool {
+		x, y = x-QUIET, y-QUIET
+		return x >= 0 && y >= 0 && x < qr.Size && y < qr.Size && qr.Modules[y][x]
+	}
+
+	var sb strings.Builder
+	for y := 0; y < qr.Size+2*QUIET; y += 2 {
+		sb.WriteString(TextControl(TERM_FG + TERM_BLACK))
+		sb.WriteString(TextControl(TERM_BG + TERM_WHITE))
+		for x := 0; x < qr.Size+2*QUIET; x++ {
+			switch top, bottom := dark(x, y), dark(x, y+1); {
+			case top && bottom:
+				sb.WriteString("█")
+			case top:
+				sb.WriteString("▀")
+			case bottom:
+				sb.WriteString("▄")
+			default:
+				sb.WriteString(" ")
+			}
+		}
+		sb.WriteString(TextControl(TERM_RESET))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// chebyshev is the distance from the center of a square pattern
+func chebyshev(dx, dy int) int {
+	if abs(dx) > abs(dy) {
+		return abs(dx)
+	}
+	return abs(dy)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
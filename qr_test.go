@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQrReedSolomon(t *testing.T) {
+	// version 1-M example from ISO/IEC 18004 annex I
+	data := []byte{0x10, 0x20, 0x0C, 0x56, 0x61, 0x80, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	expected := []byte{0xA5, 0x24, 0xD4, 0xC1, 0xED, 0x36, 0xC7, 0x87, 0x2C, 0x55}
+	cmpbytes(t, "RS", expected, qrReedSolomon(data, 10))
+}
+
+func TestQrBCH(t *testing.T) {
+	if got := qrBCH(QR_ECL_M<<3|0, 11, 0x537) ^ 0x5412; got != 0x5412 {
+		t.Errorf("format M/0: expected %x got %x", 0x5412, got)
+	}
+	if got := qrBCH(7, 13, 0x1f25); got != 0x07C94 {
+		t.Errorf("version 7: expected %x got %x", 0x07C94, got)
+	}
+}
+
+func TestQrCapacity(t *testing.T) {
+	for v := 1; v <= QR_MAX_VERSION; v++ {
+		// number of modules available for codewords
+		raw := (16*v+128)*v + 64
+		if v >= 2 {
+			n := v/7 + 2
+			raw -= (25*n-10)*n - 55
+			if v >= 7 {
+				raw -= 36
+			}
+		}
+
+		b := qrLevelM[v]
+		if total := b.dataSize() + (b.n1+b.n2)*b.ec; total != raw/8 {
+			t.Errorf("version %d: expected %d codewords got %d", v, raw/8, total)
+		}
+		if b.n2 != 0 && b.d2 != b.d1+1 {
+			t.Errorf("version %d: invalid block sizes", v)
+		}
+	}
+}
+
+func TestQrCode(t *testing.T) {
+	qr := ensure(NewQrCode([]byte("otpauth://totp/test?secret=VBWAFMHKU522CBPO")))
+	if qr.Size != 4*4+17 {
+		t.Fatalf("expected version 4, got size %d", qr.Size)
+	}
+
+	// finder pattern corners and the dark module
+	for _, c := range [][2]int{{0, 0}, {qr.Size - 1, 0}, {0, qr.Size - 1}, {8, qr.Size - 8}} {
+		if !qr.Modules[c[1]][c[0]] {
+			t.Errorf("module %v should be dark", c)
+		}
+	}
+	if qr.Modules[1][1] {
+		t.Errorf("finder should have a light ring")
+	}
+
+	lines := strings.Split(strings.TrimRight(qr.String(), "\n"), "\n")
+	if len(lines) != (qr.Size+4+1)/2 {
+		t.Errorf("unexpected height %d", len(lines))
+	}
+
+	if _, err := NewQrCode(make([]byte, 666)); err != nil {
+		t.Errorf("666 bytes should fit: %v", err)
+	}
+	if _, err := NewQrCode(make([]byte, 667)); err == nil {
+		t.Errorf("too much data should fail")
+	}
+}
+
+// Reference matrices from rsc.io/qr/coding v0.2.0 (level M, byte mode), made with
+// coding.NewPlan(version, coding.M, mask) and Plan.Encode(coding.String(data))
+var qrReferences = []struct {
+	data          string
+	version, mask int
+	matrix        string
+}{
+	{"otpauth://totp/tok", 2, 3, `
+#######.#.#.##..#.#######
+#.....#.##.####.#.#.....#
+#.###.#..###.###..#.###.#
+#.###.#.###.#.....#.###.#
+#.###.#....######.#.###.#
+#.....#...##..#.#.#.....#
+#######.#.#.#.#.#.#######
+........#..#.##.#........
+#.##.###.#..###...#..#.##
+#...#..#..###...#....#.#.
+#.#####..#.#..#.#.##.....
+..##....##.#.###.##.###..
+#.#..##.##.#.....##.#####
+.##.#..#...#.#.#..#.#...#
+.#.#.##..##.#.#.##.#####.
+#.#....###..##.#..#.#..#.
+..##..#....#....#######.#
+........##..##.##...###.#
+#######.#####...#.#.#..##
+#.....#.###.#..##...##.##
+#.###.#..#####..######...
+#.###.#.##..####.####..##
+#.###.#.######.#.##.#..#.
+#.....#...#....#.###.##..
+#######.#.#.#.#..#..#####
+`},
+	{"otpauth://totp/ACME%20Co:alice@example.com?secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP&issuer=ACME%20Co&digits=6", 7, 5, `
+#######.........###.##....########..#.#######
+#.....#.#...##.###.#.#..##..#......#..#.....#
+#.###.#.###.#.##.###.#.#...#.#####.#..#.###.#
+#.###.#.##...######..#.#.######.##.##.#.###.#
+#.###.#....#.##...#######....####.###.#.###.#
+#.....#..#.#..#.##..#...##.##.........#.....#
+#######.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#.#######
+........#.#.#####..##...##..#....####........
+#.....#.#.##.#####..######.#..##..#####..###.
+#...##..##..##....#...###.#######.##########.
+.#...#####.....##.##..#.###..###.###.##..###.
+.#..##...#..###.##...#.##.#..#..#..##....####
+.##.####..#.##..#.#.#..###....#.#..#.##.#....
+..##.#.#...#.........###.#..#.####.###....#..
+....#.##....##..#..######...##...##...##.#.#.
+####.#.####...#...#.##.#..####.#...#....#####
+#.##..#########..##.##..#....#.#......#..####
+##.#...#..##..#####...###....##.....##...####
+#...###...############..##.####.#..#.####.###
+.#.###...#..#.#.####.#.#.####.###.#....##.###
+.##.######.#..#..##.#####.##.#.#....#####...#
+###.#...#####.....#.#...##..###.#####...###..
+.##.#.#.##.#.#..#.#.#.#.#....#.#.####.#.#.##.
+...##...#..#.#.#.##.#...#.....#..##.#...###..
+#.#.#####..#..##.#########..###.#..######..##
+.#......###.....#####.###..#.##..#.#.###....#
+####..##..#....#.....#...##.#.#...#..#....##.
+###..#.##..#.#...##..#.##.######.#.....#.##.#
+##.##.#...##..##..##...#..##...#..#..#..#..##
+#..##...#.##.#.##.#.#...##.#..####.##..#..#..
+##.#..####.####..#..#.###.#####..#.##.#.###.#
+##.###..##.###...#.###.#.#.#..###..##.#..####
+#..####..##.#....####.....#..###..#..##.###..
+###..#..#.###..#.###...#.###.###.##...#.###.#
+....#.##.#..##......##.#..##..####...#.#####.
+.####....#.....#.#..##.##..##.####.##.#...#..
+#..##.#.#####..###.######.#.##..#..######..##
+........#.###.###..##...#..#.###.#..#...#.#..
+#######...#.##...##.#.#.##......###.#.#.#.##.
+#.....#....#...##..##...#.#.#..####.#...#####
+#.###.#..#..#...#...#####....#.#.#.######..#.
+#.###.#..#.#..#.#.#....###.##.#..#.....#..#.#
+#.###.#....#...#..#.#.##.####...##.###..#.#.#
+#.....#..#.##...##..#..##....#.#####.#...##..
+#######.##.#.#.#...#...####.#......#.#.##..#.
+`},
+}
+
+func TestQrReference(t *testing.T) {
+	for _, ref := range qrReferences {
+		data := []byte(ref.data)
+		qr := newQrCodeWithMask(qrAddEcc(qrEncodeData(data, ref.version), ref.version), ref.version, ref.mask)
+
+		var got strings.Builder
+		got.WriteString("\n")
+		for _, row := range qr.Modules {
+			for _, dark := range row {
+				if dark {
+					got.WriteString("#")
+				} else {
+					got.WriteString(".")
+				}
+			}
+			got.WriteString("\n")
+		}
+		if got.String() != ref.matrix {
+			t.Errorf("Version %d mask %d differs from the reference:%s", ref.version, ref.mask, got.String())
+		}
+	}
+}
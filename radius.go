@@ -0,0 +1,289 @@
+// Minimal RADIUS (RFC 2865) responder for OTP authentication.
+//
+// Only Access-Request with PAP User-Password is supported. The user name is
+// the entry name and the password is the code, or PIN+code if the entry has
+// a PIN. Requests must have a Message-Authenticator (RFC 3579) unless the
+// server allows old clients without one, it is always added to responses.
+
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	RADIUS_ACCESS_REQUEST = 1
+	RADIUS_ACCESS_ACCEPT  = 2
+	RADIUS_ACCESS_REJECT  = 3
+
+	RADIUS_USER_NAME             = 1
+	RADIUS_USER_PASSWORD         = 2
+	RADIUS_REPLY_MESSAGE         = 18
+	RADIUS_MESSAGE_AUTHENTICATOR = 80
+
+	RADIUS_HEADER_SIZE = 20
+	RADIUS_MAX_SIZE    = 4096
+	RADIUS_CACHE_TIME  = 30 * time.Second
+)
+
+// RadiusAttribute is a single type-length-value attribute
+type RadiusAttribute struct {
+	Type  byte
+	Value []byte
+}
+
+// RadiusPacket is a RADIUS packet, see RFC 2865 section 3
+type RadiusPacket struct {
+	Code          byte
+	Identifier    byte
+	Authenticator [16]byte
+	Attributes    []RadiusAttribute
+}
+
+// ParseRadiusPacket decodes a RADIUS packet
+func ParseRadiusPacket(data []byte) (*RadiusPacket, error) {
+	if len(data) < RADIUS_HEADER_SIZE {
+		return nil, fmt.Errorf("RADIUS packet too short")
+	}
+	length := int(binary.BigEndian.Uint16(data[2:4]))
+	if length < RADIUS_HEADER_SIZE || length > len(data) || length > RADIUS_MAX_SIZE {
+		return nil, fmt.Errorf("Invalid RADIUS packet length: %d", length)
+	}
+
+	p := &RadiusPacket{Code: data[0], Identifier: data[1]}
+	copy(p.Authenticator[:], data[4:20])
+
+	attrs := data[RADIUS_HEADER_SIZE:length]
+	for len(attrs) > 0 {
+		if len(attrs) < 2 || attrs[1] < 2 || int(attrs[1]) > len(attrs) {
+			return nil, fmt.Errorf("Invalid RADIUS attribute")
+		}
+		p.Attributes = append(p.Attributes, RadiusAttribute{attrs[0], attrs[2:attrs[1]]})
+		attrs = attrs[attrs[1]:]
+	}
+	return p, nil
+}
+
+// Bytes encodes the packet
+func (p RadiusPacket) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{p.Code, p.Identifier, 0, 0})
+	buf.Write(p.Authenticator[:])
+	for _, a := range p.Attributes {
+		buf.Write([]byte{a.Type, byte(len(a.Value) + 2)})
+		buf.Write(a.Value)
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint16(data[2:4], uint16(len(data)))
+	return data
+}
+
+// Attribute returns the value of the first attribute of this type, or nil
+func (p RadiusPacket) Attribute(t byte) []byte {
+	for _, a := range p.Attributes {
+		if a.Type == t {
+			return a.Value
+		}
+	}
+	return nil
+}
+
+// messageAuthenticator computes the RFC 3579 Message-Authenticator, with
+// the authenticator field set to auth and the attribute itself zeroed
+func (p RadiusPacket) messageAuthenticator(secret []byte, auth [16]byte) []byte {
+	tmp := p
+	tmp.Authenticator = auth
+	tmp.Attributes = nil
+	for _, a := range p.Attributes {
+		if a.Type == RADIUS_MESSAGE_AUTHENTICATOR {
+			a.Value = make([]byte, md5.Size)
+		}
+		tmp.Attributes = append(tmp.Attributes, a)
+	}
+
+	mac := hmac.New(md5.New, secret)
+	mac.Write(tmp.Bytes())
+	return mac.Sum(nil)
+}
+
+// radiusPasswordHash is the hiding function from RFC 2865 section 5.2
+func radiusPasswordHash(secret, prev []byte) []byte {
+	h := md5.New()
+	h.Write(secret)
+	h.Write(prev)
+	return h.Sum(nil)
+}
+
+// RadiusEncryptPassword hides a User-Password, the client side of RadiusDecryptPassword
+func RadiusEncryptPassword(password, secret []byte, auth [16]byte) []byte {
+	n := (len(password) + 15) / 16 * 16
+	if n == 0 {
+		n = 16
+	}
+	enc := make([]byte, n)
+	copy(enc, password)
+
+	prev := auth[:]
+	for i := 0; i < n; i += 16 {
+		b := radiusPasswordHash(secret, prev)
+		for j := 0; j < 16; j++ {
+			enc[i+j] ^= b[j]
+		}
+		prev = enc[i : i+16]
+	}
+	return enc
+}
+
+// RadiusDecryptPassword recovers a User-Password hidden with the shared secret
+func RadiusDecryptPassword(enc, secret []byte, auth [16]byte) ([]byte, error) {
+	if len(enc) == 0 || len(enc)%16 != 0 || len(enc) > 128 {
+		return nil, fmt.Errorf("Invalid User-Password length: %d", len(enc))
+	}
+
+	dec := make([]byte, len(enc))
+	prev := auth[:]
+	for i := 0; i < len(enc); i += 16 {
+		b := radiusPasswordHash(secret, prev)
+		for j := 0; j < 16; j++ {
+			dec[i+j] = enc[i+j] ^ b[j]
+		}
+		prev = enc[i : i+16]
+	}
+	return bytes.TrimRight(dec, "\x00"), nil
+}
+
+// RadiusServer answers Access-Requests by validating OTP codes
+type RadiusServer struct {
+	Secret    []byte
+	Validator *Validator
+	// AllowNoAuthenticator accepts requests without a Message-Authenticator, for clients that can't send one
+	AllowNoAuthenticator bool
+
+	// responses are cached so retransmitted requests get the same answer,
+	// otherwise the replay protection would reject them
+	cache map[string]radiusCached
+	mutex sync.Mutex
+}
+
+type radiusCached struct {
+	response []byte
+	expires  time.Time
+}
+
+// NewRadiusServer creates a RADIUS responder using the validator and shared secret
+func NewRadiusServer(secret []byte, v *Validator) *RadiusServer {
+	return &RadiusServer{
+		Secret:    secret,
+		Validator: v,
+		cache:     make(map[string]radiusCached),
+	}
+}
+
+// Handle processes one request from the client, returns the response or nil if it should be dropped
+func (s *RadiusServer) Handle(client string, data []byte) []byte {
+	req, err := ParseRadiusPacket(data)
+	if err != nil {
+		log.Printf("RADIUS %s: %v\n", client, err)
+		return nil
+	}
+	if req.Code != RADIUS_ACCESS_REQUEST {
+		log.Printf("RADIUS %s: unsupported code %d\n", client, req.Code)
+		return nil
+	}
+
+	// requests with a bad or missing Message-Authenticator must be silently dropped
+	ma := req.Attribute(RADIUS_MESSAGE_AUTHENTICATOR)
+	if ma == nil && !s.AllowNoAuthenticator {
+		log.Printf("RADIUS %s: no Message-Authenticator, configure the client to send one\n", client)
+		return nil
+	}
+	if ma != nil && !hmac.Equal(ma, req.messageAuthenticator(s.Secret, req.Authenticator)) {
+		log.Printf("RADIUS %s: invalid Message-Authenticator, check the shared secret\n", client)
+		return nil
+	}
+
+	key := fmt.Sprintf("%s/%d/%x", client, req.Identifier, req.Authenticator)
+	if response := s.cached(key); response != nil {
+		return response
+	}
+
+	name := string(req.Attribute(RADIUS_USER_NAME))
+	password, err := RadiusDecryptPassword(req.Attribute(RADIUS_USER_PASSWORD), s.Secret, req.Authenticator)
+	if err == nil {
+		_, err = s.Validator.Validate(name, string(password))
+	}
+
+	// don't tell the client why it failed, but log it
+	var response []byte
+	if err != nil {
+		log.Printf("RADIUS %s '%s': rejected, %v\n", client, name, logReason(err))
+		response = s.response(req, RADIUS_ACCESS_REJECT, "Authentication failed")
+	} else {
+		log.Printf("RADIUS %s '%s': accepted\n", client, name)
+		response = s.response(req, RADIUS_ACCESS_ACCEPT, "Authentication successful")
+	}
+
+	s.mutex.Lock()
+	s.cache[key] = radiusCached{response, time.Now().Add(RADIUS_CACHE_TIME)}
+	s.mutex.Unlock()
+	return response
+}
+
+// cached returns the previous response to the same request and drops expired responses
+func (s *RadiusServer) cached(key string) []byte {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for k, c := range s.cache {
+		if now.After(c.expires) {
+			delete(s.cache, k)
+		}
+	}
+	return s.cache[key].response
+}
+
+// response creates an Access-Accept or Access-Reject for the request
+func (s *RadiusServer) response(req *RadiusPacket, code byte, message string) []byte {
+	resp := RadiusPacket{
+		Code:       code,
+		Identifier: req.Identifier,
+		Attributes: []RadiusAttribute{
+			{RADIUS_REPLY_MESSAGE, []byte(message)},
+			{RADIUS_MESSAGE_AUTHENTICATOR, make([]byte, md5.Size)},
+		},
+	}
+	resp.Attributes[1].Value = resp.messageAuthenticator(s.Secret, req.Authenticator)
+
+	// Response Authenticator = MD5(Code+ID+Length+RequestAuth+Attributes+Secret)
+	resp.Authenticator = req.Authenticator
+	h := md5.New()
+	h.Write(resp.Bytes())
+	h.Write(s.Secret)
+	copy(resp.Authenticator[:], h.Sum(nil))
+	return resp.Bytes()
+}
+
+// Serve answers requests on the connection until it is closed
+func (s *RadiusServer) Serve(conn net.PacketConn) error {
+	buffer := make([]byte, RADIUS_MAX_SIZE)
+	for {
+		n, addr, err := conn.ReadFrom(buffer)
+		if err != nil {
+			return err
+		}
+		if response := s.Handle(addr.String(), buffer[:n]); response != nil {
+			if _, err := conn.WriteTo(response, addr); err != nil {
+				log.Printf("RADIUS %s: %v\n", addr, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"net"
+	"testing"
+	"time"
+)
+
+const RADIUS_SECRET = "testing123"
+
+// radiusRequest is a client stand-in that creates an Access-Request
+func radiusRequest(id byte, name, password string, withMA bool) *RadiusPacket {
+	req := &RadiusPacket{Code: RADIUS_ACCESS_REQUEST, Identifier: id}
+	copy(req.Authenticator[:], secureRandom(16))
+	req.Attributes = []RadiusAttribute{
+		{RADIUS_USER_NAME, []byte(name)},
+		{RADIUS_USER_PASSWORD, RadiusEncryptPassword([]byte(password), []byte(RADIUS_SECRET), req.Authenticator)},
+	}
+	if withMA {
+		req.Attributes = append(req.Attributes, RadiusAttribute{RADIUS_MESSAGE_AUTHENTICATOR, make([]byte, md5.Size)})
+		req.Attributes[2].Value = req.messageAuthenticator([]byte(RADIUS_SECRET), req.Authenticator)
+	}
+	return req
+}
+
+// checkRadiusResponse verifies the response like a client would and returns its code
+func checkRadiusResponse(t *testing.T, req *RadiusPacket, data []byte) byte {
+	resp, err := ParseRadiusPacket(data)
+	if err != nil {
+		t.Fatalf("Unable to parse response: %v", err)
+	}
+	if resp.Identifier != req.Identifier {
+		t.Errorf("Response has wrong identifier %d", resp.Identifier)
+	}
+
+	tmp := *resp
+	tmp.Authenticator = req.Authenticator
+	h := md5.New()
+	h.Write(tmp.Bytes())
+	h.Write([]byte(RADIUS_SECRET))
+	if !bytes.Equal(h.Sum(nil), resp.Authenticator[:]) {
+		t.Errorf("Invalid Response Authenticator")
+	}
+	if !hmac.Equal(resp.Attribute(RADIUS_MESSAGE_AUTHENTICATOR), resp.messageAuthenticator([]byte(RADIUS_SECRET), req.Authenticator)) {
+		t.Errorf("Invalid Message-Authenticator in response")
+	}
+	return resp.Code
+}
+
+func TestRadiusPassword(t *testing.T) {
+	var auth [16]byte
+	copy(auth[:], secureRandom(16))
+
+	for _, password := range []string{"1", "123456", "0123456789abcdef", "a much longer pin and password12345678"} {
+		enc := RadiusEncryptPassword([]byte(password), []byte(RADIUS_SECRET), auth)
+		if len(enc)%16 != 0 {
+			t.Errorf("Encrypted password has invalid length %d", len(enc))
+		}
+		dec, err := RadiusDecryptPassword(enc, []byte(RADIUS_SECRET), auth)
+		if err != nil || string(dec) != password {
+			t.Errorf("Password decryption: expected '%s' got '%s' (%v)", password, dec, err)
+		}
+	}
+}
+
+func TestRadiusAccess(t *testing.T) {
+	v, e := testValidator(t, 59)
+	e.Pin = "secret-pin"
+	s := NewRadiusServer([]byte(RADIUS_SECRET), v)
+
+	tests := []struct {
+		name     string
+		password string
+		code     byte
+	}{
+		{"service", "94287082", RADIUS_ACCESS_REJECT}, // PIN missing
+		{"service", "wrong-pin94287082", RADIUS_ACCESS_REJECT},
+		{"unknown", "secret-pin94287082", RADIUS_ACCESS_REJECT},
+		{"service", "secret-pin94287082", RADIUS_ACCESS_ACCEPT},
+		{"service", "secret-pin94287082", RADIUS_ACCESS_REJECT}, // replayed
+	}
+
+	for i, test := range tests {
+		req := radiusRequest(byte(i), test.name, test.password, true)
+		data := req.Bytes()
+		response := s.Handle("client", data)
+		if response == nil {
+			t.Fatalf("No response to request %d", i)
+		}
+		if code := checkRadiusResponse(t, req, response); code != test.code {
+			t.Errorf("%s '%s': expected %d got %d", test.name, test.password, test.code, code)
+		}
+
+		// a retransmission should get the same answer
+		if again := s.Handle("client", data); !bytes.Equal(again, response) {
+			t.Errorf("Retransmitted request %d got a different response", i)
+		}
+	}
+
+	// requests with a bad Message-Authenticator are dropped
+	req := radiusRequest(99, "service", "secret-pin94287082", true)
+	req.Attributes[2].Value[0] ^= 1
+	if response := s.Handle("client", req.Bytes()); response != nil {
+		t.Errorf("Request with bad Message-Authenticator was answered")
+	}
+
+	// and so are requests without one, unless old clients are allowed
+	req = radiusRequest(100, "service", "secret-pin", false)
+	if response := s.Handle("client", req.Bytes()); response != nil {
+		t.Errorf("Request without Message-Authenticator was answered")
+	}
+	s.AllowNoAuthenticator = true
+	if response := s.Handle("client", req.Bytes()); response == nil || checkRadiusResponse(t, req, response) != RADIUS_ACCESS_REJECT {
+		t.Errorf("Request without Message-Authenticator was not answered")
+	}
+}
+
+func TestRadiusServe(t *testing.T) {
+	v, _ := testValidator(t, 59)
+	s := NewRadiusServer([]byte(RADIUS_SECRET), v)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	defer conn.Close()
+	go s.Serve(conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Unable to connect: %v", err)
+	}
+	defer client.Close()
+
+	req := radiusRequest(1, "service", "94287082", true)
+	client.Write(req.Bytes())
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buffer := make([]byte, RADIUS_MAX_SIZE)
+	n, err := client.Read(buffer)
+	if err != nil {
+		t.Fatalf("No response from server: %v", err)
+	}
+	if code := checkRadiusResponse(t, req, buffer[:n]); code != RADIUS_ACCESS_ACCEPT {
+		t.Errorf("Expected Access-Accept got %d", code)
+	}
+}
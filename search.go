@@ -0,0 +1,202 @@
+// Ranked fuzzy search
+//
+// The query is matched as a subsequence of the name, issuer, tags and note of
+// each entry. Matches at the start of the text, at the start of words and runs
+// of consecutive characters score higher, gaps score lower. If the query is
+// not a subsequence, a word within a small edit distance still gives a low score
+// so that simple typos are tolerated.
+
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	SCORE_CHAR        = 1
+	SCORE_CONSECUTIVE = 4
+	SCORE_WORD_START  = 6
+	SCORE_PREFIX      = 8
+	SCORE_MAX_GAP     = 3           // gaps cost one per character up to this
+	SCORE_EXACT       = math.MaxInt // index, id or exact name
+
+	// the best match is picked if it scores this many times more than the next
+	SEARCH_CLEAR_WINNER = 2
+)
+
+// Match is an entry found by a search and how well it matched
+type Match struct {
+	Entry *Entry
+	Score int
+}
+
+// rank scores all entries and returns the ones that matched, best first.
+// Entries with the same score keep their order
+func rank(entries []*Entry, query string) []Match {
+	var ret []Match
+	for _, e := range entries {
+		if score := entryScore(query, e); score > 0 {
+			ret = append(ret, Match{Entry: e, Score: score})
+		}
+	}
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Score > ret[j].Score })
+	return ret
+}
+
+// clearWinner returns the best match if it is clearly better than the others
+func clearWinner(matches []Match) *Entry {
+	if len(matches) == 1 ||
+		(len(matches) > 1 && matches[0].Score > 0 && matches[0].Score >= SEARCH_CLEAR_WINNER*matches[1].Score) {
+		return matches[0].Entry
+	}
+	return nil
+}
+
+// entryScore is the best score of the fields, the name counts the most
+func entryScore(query string, e *Entry) int {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return 0
+	}
+
+	best := 2 * textScore(query, e.Name)
+	for _, text := range append([]string{e.Issuer}, e.Tags...) {
+		best = maxInt(best, textScore(query, text))
+	}
+	if score := textScore(query, e.Note); score > 0 {
+		best = maxInt(best, maxInt(score/2, 1))
+	}
+	return best
+}
+
+// textScore scores a (lower case) query against a text, 0 if it doesn't match
+func textScore(query, text string) int {
+	if score := subsequenceScore([]rune(query), []rune(text)); score > 0 {
+		return score
+	}
+	return typoScore(query, text)
+}
+
+// subsequenceScore tries every position where the query can start and
+// matches the rest greedily, returning the best score
+func subsequenceScore(query, text []rune) int {
+	lower := []rune(strings.ToLower(string(text)))
+	if len(lower) != len(text) {
+		lower = text // some runes change length in lower case, compare as is
+	}
+
+	best := 0
+	for start := range lower {
+		if lower[start] != query[0] {
+			continue
+		}
+
+		score, last, q := 0, -1, 0
+		for i := start; i < len(lower) && q < len(query); i++ {
+			if lower[i] != query[q] {
+				continue
+			}
+			score += SCORE_CHAR
+			switch {
+			case i == 0:
+				score += SCORE_PREFIX + SCORE_WORD_START
+			case isWordStart(text, i):
+				score += SCORE_WORD_START
+			}
+			if last >= 0 {
+				if i == last+1 {
+					score += SCORE_CONSECUTIVE
+				} else {
+					score -= minInt(i-last-1, SCORE_MAX_GAP)
+				}
+			}
+			last = i
+			q++
+		}
+		if q == len(query) {
+			best = maxInt(best, maxInt(score, 1))
+		}
+	}
+	return best
+}
+
+// isWordStart checks if a word starts at position i, either after a separator
+// or as an upper case letter after a lower case one ("GitHub")
+func isWordStart(text []rune, i int) bool {
+	prev, curr := text[i-1], text[i]
+	if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+		return true
+	}
+	return unicode.IsLower(prev) && unicode.IsUpper(curr)
+}
+
+// typoScore gives a low score if a word in the text, or the whole text, is within
+// a small edit distance from the query. Short queries must match exactly
+func typoScore(query, text string) int {
+	allowed := 0
+	switch n := len([]rune(query)); {
+	case n > 6:
+		allowed = 2
+	case n > 3:
+		allowed = 1
+	default:
+		return 0
+	}
+
+	text = strings.ToLower(text)
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	best := 0
+	for _, word := range append(words, text) {
+		if d := editDistance(query, word); d <= allowed {
+			best = maxInt(best, len(query)-2*d)
+		}
+	}
+	return best
+}
+
+// editDistance is the optimal string alignment distance, i.e. Levenshtein
+// distance where swapping two adjacent characters also counts as one edit
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// three rows are enough, d[i] only depends on d[i-1] and d[i-2]
+	prev2 := make([]int, len(t)+1)
+	prev := make([]int, len(t)+1)
+	curr := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		curr[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				curr[j] = minInt(curr[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(t)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"github", "github", 0},
+		{"gihtub", "github", 1}, // transposition
+		{"githb", "github", 1},
+		{"gitlab", "github", 2},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+	}
+	for _, test := range tests {
+		if got := editDistance(test.a, test.b); got != test.want {
+			t.Errorf("editDistance(%q, %q) = %d, wanted %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestTextScore(t *testing.T) {
+	if textScore("gthub", "GitHub") == 0 {
+		t.Errorf("Subsequence did not match")
+	}
+	if textScore("gihtub", "GitHub") == 0 {
+		t.Errorf("Typo did not match")
+	}
+	if textScore("xyz", "GitHub") != 0 || textScore("abc", "acb") != 0 {
+		t.Errorf("Unrelated text matched")
+	}
+
+	// prefixes and word starts beat matches in the middle of a word
+	if textScore("gh", "GitHub") <= textScore("gh", "laughing") {
+		t.Errorf("Word starts did not score higher")
+	}
+	if textScore("aws", "aws prod") <= textScore("aws", "my aws") {
+		t.Errorf("Prefix did not score higher")
+	}
+	if textScore("hub", "xhubx") <= textScore("hub", "xhxuxbx") {
+		t.Errorf("Consecutive characters did not score higher")
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	db := &Database{}
+	github := add(db, "GitHub", "NZSXMZLSEBTW63TOME")
+	gitlab := add(db, "gitlab work", "M5UXMZJAPFXXKIDVOA")
+	mail := add(db, "mail", "NZSXMZLSEBTW63TOME")
+	mail.Issuer = "Fastmail"
+	mail.Note = "personal account"
+	bank := add(db, "bank", "M5UXMZJAPFXXKIDVOA")
+	bank.Tags = []string{"finance"}
+
+	best := func(query string) *Entry {
+		matches, err := db.Search(query)
+		if err != nil || len(matches) == 0 {
+			t.Errorf("Search '%s' failed: %v", query, err)
+			return nil
+		}
+		return matches[0].Entry
+	}
+	if best("gthub") != github || best("gihtub") != github || best("glw") != gitlab {
+		t.Errorf("Name was not ranked first")
+	}
+	if best("fastm") != mail || best("persnal") != mail || best("finance") != bank {
+		t.Errorf("Issuer, note or tag was not found")
+	}
+
+	// "git" matches two names equally well, "gith" is a clear winner
+	if matches, _ := db.Search("git"); len(matches) != 2 || clearWinner(matches) != nil {
+		t.Errorf("Ambiguous search had a winner: %v", matches)
+	}
+	if matches, _ := db.Search("gith"); clearWinner(matches) != github {
+		t.Errorf("Clear winner was not picked: %v", matches)
+	}
+	if matches, _ := db.Search("qqq"); len(matches) != 0 {
+		t.Errorf("Unrelated search matched: %v", matches)
+	}
+	for _, query := range []string{"", "#", "@"} {
+		if matches, err := db.Search(query); err == nil {
+			t.Errorf("Search '%s' should fail: %v", query, matches)
+		}
+	}
+}
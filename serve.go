@@ -0,0 +1,248 @@
+// A small OTP validation service for internal services and test environments.
+//
+// POST /verify with the form values "name" and "code" returns 200 if the code
+// (prefixed with the PIN if the entry has one) is accepted, 403 if it is rejected and 429 if the entry is rate limited or locked.
+
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SERVE_MAX_FAILURES = 5
+	SERVE_LOCKOUT_TIME = 15 * time.Minute
+	SERVE_RATE_LIMIT   = 10    // attempts per name and minute
+	SERVE_MAX_TRACKED  = 10000 // names with recent attempts, older ones are forgotten above this
+)
+
+var (
+	errRateLimited = fmt.Errorf("too many attempts, try again later")
+	errLocked      = fmt.Errorf("too many failures, entry is locked")
+)
+
+// rejected is returned for unknown entries and wrong codes alike, so that clients
+// can't find out which entries exist. The reason is only for the local log
+type rejected struct {
+	reason error
+}
+
+func (r rejected) Error() string {
+	return "invalid name or code"
+}
+
+// logReason returns the reason of a rejection, or the error itself
+func logReason(err error) error {
+	if r, ok := err.(rejected); ok {
+		return r.reason
+	}
+	return err
+}
+
+// attempts keeps track of recent verification attempts for one entry
+type attempts struct {
+	failures    int
+	lockedUntil time.Time
+	minute      int64
+	count       int
+}
+
+// Validator verifies codes against the database with rate limiting and lockout.
+// Accepted counters are saved to the database, so codes can't be replayed after a restart.
+// The database is reloaded if another process changed it, so those changes are kept
+type Validator struct {
+	Window      int
+	MaxFailures int
+	LockoutTime time.Duration
+	RateLimit   int
+
+	db       *Database
+	attempts map[string]*attempts // by name, also for unknown names
+	mutex    sync.Mutex
+	now      func() time.Time
+}
+
+// NewValidator creates a validator for the database with default limits
+func NewValidator(db *Database, window int) *Validator {
+	return &Validator{
+		Window:      window,
+		MaxFailures: SERVE_MAX_FAILURES,
+		LockoutTime: SERVE_LOCKOUT_TIME,
+		RateLimit:   SERVE_RATE_LIMIT,
+		db:          db,
+		attempts:    make(map[string]*attempts),
+		now:         time.Now,
+	}
+}
+
+// Validate checks a code for the entry with this exact name, returns the drift if accepted.
+// If the entry has a PIN the password must be the PIN followed by the code
+func (v *Validator) Validate(name, password string) (int, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	now := v.now()
+	a := v.attempts[name]
+	if a == nil {
+		v.forget(now)
+		a = &attempts{}
+		v.attempts[name] = a
+	}
+
+	// 1. check lockout and rate limit, before looking at the name
+	if now.Before(a.lockedUntil) {
+		return 0, errLocked
+	}
+	if minute := now.Unix() / 60; minute != a.minute {
+		a.minute, a.count = minute, 0
+	}
+	a.count++
+	if a.count > v.RateLimit {
+		return 0, errRateLimited
+	}
+
+	// 2. verify PIN and code on the latest database and store the new counter,
+	// lock the name after too many failures
+	var drift int
+	err := v.db.Update(func() error {
+		entry := v.db.findExact(name)
+		if entry == nil {
+			return rejected{fmt.Errorf("unknown entry '%s'", name)}
+		}
+		var err error
+		if drift, err = verifyPassword(entry, password, now, v.Window); err != nil {
+			return rejected{err}
+		}
+		return nil
+	})
+	if _, ok := err.(rejected); ok {
+		a.failures++
+		if a.failures >= v.MaxFailures {
+			a.failures = 0
+			a.lockedUntil = now.Add(v.LockoutTime)
+		}
+		return 0, err
+	}
+	if err != nil {
+		return 0, err
+	}
+	a.failures = 0
+	return drift, nil
+}
+
+// forget drops the names that are neither locked nor used this minute, when there are too many
+func (v *Validator) forget(now time.Time) {
+	if len(v.attempts) < SERVE_MAX_TRACKED {
+		return
+	}
+	for name, a := range v.attempts {
+		if !now.Before(a.lockedUntil) && a.minute != now.Unix()/60 {
+			delete(v.attempts, name)
+		}
+	}
+}
+
+// verifyPassword checks a PIN+OTP password, or only the code if the entry has no PIN
+// or if the PIN is used to create the code
+func verifyPassword(entry *Entry, password string, now time.Time, window int) (int, error) {
+	if entry.PinInCode() {
+		return entry.Verify(password, now, window)
+	}
+
+	n := len(password) - int(entry.Digits)
+	if n < 0 || n != len(entry.Pin) {
+		return 0, fmt.Errorf("invalid code")
+	}
+	if subtle.ConstantTimeCompare([]byte(password[:n]), []byte(entry.Pin)) != 1 {
+		return 0, fmt.Errorf("invalid PIN")
+	}
+	return entry.Verify(password[n:], now, window)
+}
+
+// ServeHTTP implements the /verify endpoint
+func (v *Validator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/verify" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, code := r.FormValue("name"), r.FormValue("code")
+	drift, err := v.Validate(name, code)
+
+	status := http.StatusOK
+	reply := map[string]any{"accepted": err == nil}
+	if err == nil {
+		reply["drift"] = drift
+	} else {
+		reply["reason"] = err.Error()
+		status = http.StatusForbidden
+		if err == errLocked || err == errRateLimited {
+			status = http.StatusTooManyRequests
+		}
+	}
+	if err != nil {
+		log.Printf("%s '%s': %v (%v)\n", r.RemoteAddr, name, reply, logReason(err))
+	} else {
+		log.Printf("%s '%s': %v\n", r.RemoteAddr, name, reply)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(reply)
+}
+
+// listenLocal listens on a unix socket ("unix:/path") or on a loopback address
+func listenLocal(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, 0600); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("refusing to listen on non-loopback address '%s'", address)
+	}
+	return net.Listen("tcp", address)
+}
+
+// Serve runs the validator on a local address until something is received on stop
+func Serve(address string, v *Validator, stop <-chan os.Signal) error {
+	l, err := listenLocal(address)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-stop
+		l.Close() // this also removes the unix socket
+	}()
+
+	log.Printf("Listening on %s\n", address)
+	if err := http.Serve(l, v); !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// helper that creates a validator with a single RFC 6238 entry at a fixed time
+func testValidator(t *testing.T, now int64) (*Validator, *Entry) {
+	db := ensure(CreateDatabase(t.TempDir()+"/test.tokdb", "password"))
+	e := ensure(NewEntry("service", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", "sha1", "", 30, 8))
+	db.Add(e)
+
+	v := NewValidator(db, 1)
+	v.now = func() time.Time { return time.Unix(now, 0) }
+	return v, e
+}
+
+func post(v *Validator, name, code string) int {
+	status, _ := postBody(v, name, code)
+	return status
+}
+
+func postBody(v *Validator, name, code string) (int, string) {
+	form := url.Values{"name": {name}, "code": {code}}
+	r := httptest.NewRequest("POST", "/verify", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	v.ServeHTTP(w, r)
+	return w.Code, w.Body.String()
+}
+
+func TestServeVerify(t *testing.T) {
+	v, e := testValidator(t, 59)
+
+	if code := post(v, "service", "94287082"); code != http.StatusOK {
+		t.Errorf("Valid code: expected %d got %d", http.StatusOK, code)
+	}
+	if code := post(v, "service", "94287082"); code != http.StatusForbidden {
+		t.Errorf("Replayed code: expected %d got %d", http.StatusForbidden, code)
+	}
+	if code := post(v, "unknown", "94287082"); code != http.StatusForbidden {
+		t.Errorf("Unknown entry: expected %d got %d", http.StatusForbidden, code)
+	}
+
+	// the counter should have been saved
+	db := ensure(LoadDatabase(v.db.filename, "password"))
+	if db.Entries[0].Counter != 1 || e.Counter != 1 {
+		t.Errorf("Counter was not saved: %d", db.Entries[0].Counter)
+	}
+}
+
+func TestServeLockout(t *testing.T) {
+	v, _ := testValidator(t, 59)
+	v.MaxFailures = 3
+
+	for i := 0; i < 3; i++ {
+		if code := post(v, "service", "00000000"); code != http.StatusForbidden {
+			t.Errorf("Invalid code: expected %d got %d", http.StatusForbidden, code)
+		}
+	}
+	if code := post(v, "service", "94287082"); code != http.StatusTooManyRequests {
+		t.Errorf("Locked entry: expected %d got %d", http.StatusTooManyRequests, code)
+	}
+
+	// after the lockout the code works again, but it has expired so allow more skew
+	v.now = func() time.Time { return time.Unix(59, 0).Add(v.LockoutTime) }
+	v.Window = 40
+	if code := post(v, "service", "94287082"); code != http.StatusOK {
+		t.Errorf("Lockout expired: expected %d got %d", http.StatusOK, code)
+	}
+}
+
+func TestServeRateLimit(t *testing.T) {
+	v, _ := testValidator(t, 59)
+	v.MaxFailures = 100
+
+	for i := 0; i < v.RateLimit; i++ {
+		post(v, "service", "00000000")
+	}
+	if code := post(v, "service", "94287082"); code != http.StatusTooManyRequests {
+		t.Errorf("Rate limited entry: expected %d got %d", http.StatusTooManyRequests, code)
+	}
+}
+
+func TestServeUnknownEntry(t *testing.T) {
+	v, _ := testValidator(t, 59)
+	v.MaxFailures = 100
+
+	// unknown names get the same answer as wrong codes, and are rate limited too
+	_, wrong := postBody(v, "service", "00000000")
+	if _, unknown := postBody(v, "unknown", "00000000"); unknown != wrong {
+		t.Errorf("Unknown entry can be told apart: '%s' vs '%s'", unknown, wrong)
+	}
+	for i := 1; i < v.RateLimit; i++ {
+		post(v, "unknown", "00000000")
+	}
+	if code := post(v, "unknown", "00000000"); code != http.StatusTooManyRequests {
+		t.Errorf("Unknown entry was not rate limited: got %d", code)
+	}
+}
+
+func TestServeKeepsOtherChanges(t *testing.T) {
+	v, _ := testValidator(t, 59)
+	ensure(0, v.db.Save())
+
+	// another process adds an entry while the validator is running
+	other := ensure(LoadDatabase(v.db.filename, "password"))
+	add(other, "added", "NZSXMZLSEBTW63TOME")
+	ensure(0, other.Save())
+
+	if code := post(v, "service", "94287082"); code != http.StatusOK {
+		t.Errorf("Valid code: expected %d got %d", http.StatusOK, code)
+	}
+	db := ensure(LoadDatabase(v.db.filename, "password"))
+	if len(db.Entries) != 2 || db.findExact("service").Counter != 1 {
+		t.Errorf("Changes were lost: %v", db.Entries)
+	}
+}
+
+func TestListenLocal(t *testing.T) {
+	if _, err := listenLocal("192.0.2.1:8632"); err == nil {
+		t.Errorf("Non-loopback address was accepted")
+	}
+
+	l, err := listenLocal("unix:" + t.TempDir() + "/tok.sock")
+	if err != nil {
+		t.Fatalf("Unable to listen on unix socket: %v", err)
+	}
+	l.Close()
+}
@@ -0,0 +1,164 @@
+// Shamir secret sharing over GF(256), used to split the recovery key
+// see https://en.wikipedia.org/wiki/Shamir%27s_secret_sharing
+//
+// Each byte of the secret is the constant term of a random polynomial of
+// degree k-1, share x contains the polynomials evaluated at x. Any k shares
+// can recreate the secret using Lagrange interpolation at 0.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base32"
+	"fmt"
+	"strings"
+)
+
+const (
+	SHAMIR_CHECKSUM_SIZE = 4
+	SHAMIR_GROUP_SIZE    = 5
+)
+
+var (
+	shareEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	gfExp [510]byte
+	gfLog [256]byte
+)
+
+// build the exp/log tables for GF(256) with the AES polynomial x^8+x^4+x^3+x+1 and generator 3
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = byte(i)
+
+		// x *= 3
+		hi := x & 0x80
+		x2 := x << 1
+		if hi != 0 {
+			x2 ^= 0x1b
+		}
+		x ^= x2
+	}
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// ShamirSplit splits the secret into n shares where k are needed to recreate it.
+// Each share is <k><x><y...>, with k=1 the single share is simply the secret
+func ShamirSplit(secret []byte, n, k int) ([][]byte, error) {
+	if k < 1 || k > n || n > 255 {
+		return nil, fmt.Errorf("Invalid number of shares: %d of %d", k, n)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, 2+len(secret))
+		shares[i][0] = byte(k)
+		shares[i][1] = byte(i + 1)
+	}
+
+	for j, s := range secret {
+		// random polynomial with the secret as constant term
+		coeffs := append([]byte{s}, secureRandom(k-1)...)
+		for i := range shares {
+			x := shares[i][1]
+			var y byte
+			for c := len(coeffs) - 1; c >= 0; c-- { // Horner's method
+				y = gfMul(y, x) ^ coeffs[c]
+			}
+			shares[i][2+j] = y
+		}
+	}
+	return shares, nil
+}
+
+// ShamirCombine recreates the secret from at least k shares
+func ShamirCombine(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("No shares given")
+	}
+	k, size := int(shares[0][0]), len(shares[0])
+	if len(shares) < k {
+		return nil, fmt.Errorf("Need %d shares, got %d", k, len(shares))
+	}
+	shares = shares[:k]
+
+	for i, share := range shares {
+		if len(share) != size || int(share[0]) != k || share[1] == 0 {
+			return nil, fmt.Errorf("Shares are not from the same split")
+		}
+		for _, other := range shares[:i] {
+			if share[1] == other[1] {
+				return nil, fmt.Errorf("Share %d was given twice", share[1])
+			}
+		}
+	}
+
+	secret := make([]byte, size-2)
+	for i, share := range shares {
+		// Lagrange basis polynomial for this share, evaluated at 0
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other[1], other[1]^share[1]))
+			}
+		}
+		for j := range secret {
+			secret[j] ^= gfMul(basis, share[2+j])
+		}
+	}
+	return secret, nil
+}
+
+// ShareToString encodes a share with a checksum as groups of base32 characters
+func ShareToString(share []byte) string {
+	sum := sha256.Sum256(share)
+	data := append(append([]byte{}, share...), sum[:SHAMIR_CHECKSUM_SIZE]...)
+	str := shareEncoding.EncodeToString(data)
+
+	var groups []string
+	for len(str) > SHAMIR_GROUP_SIZE {
+		groups = append(groups, str[:SHAMIR_GROUP_SIZE])
+		str = str[SHAMIR_GROUP_SIZE:]
+	}
+	return strings.Join(append(groups, str), "-")
+}
+
+// ShareFromString decodes a share created by ShareToString and verifies its checksum
+func ShareFromString(str string) ([]byte, error) {
+	str = strings.ToUpper(strings.TrimSpace(str))
+	str = strings.ReplaceAll(str, "-", "")
+	str = strings.ReplaceAll(str, " ", "")
+
+	data, err := shareEncoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid share: %v", err)
+	}
+	if len(data) < 2+SHAMIR_CHECKSUM_SIZE {
+		return nil, fmt.Errorf("Invalid share: too short")
+	}
+
+	n := len(data) - SHAMIR_CHECKSUM_SIZE
+	share, checksum := data[:n], data[n:]
+	sum := sha256.Sum256(share)
+	if !bytes.Equal(checksum, sum[:SHAMIR_CHECKSUM_SIZE]) {
+		return nil, fmt.Errorf("Invalid share: checksum error, check for typos")
+	}
+	return share, nil
+}
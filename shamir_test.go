@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGF256(t *testing.T) {
+	// examples from FIPS 197
+	if got := gfMul(0x57, 0x83); got != 0xc1 {
+		t.Errorf("0x57 * 0x83: expected 0xc1 got %#x", got)
+	}
+	if got := gfMul(0x57, 0x13); got != 0xfe {
+		t.Errorf("0x57 * 0x13: expected 0xfe got %#x", got)
+	}
+	if got := gfMul(0x53, 0xca); got != 0x01 {
+		t.Errorf("0x53 * 0xca: expected 0x01 got %#x", got)
+	}
+
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if gfDiv(gfMul(byte(a), byte(b)), byte(b)) != byte(a) {
+				t.Fatalf("(%d * %d) / %d != %d", a, b, b, a)
+			}
+		}
+	}
+}
+
+func TestShamir(t *testing.T) {
+	secret := secureRandom(32)
+	shares, err := ShamirSplit(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Unable to split secret: %v", err)
+	}
+
+	// every combination of 3 shares should work
+	for i := 0; i < 5; i++ {
+		for j := i + 1; j < 5; j++ {
+			for k := j + 1; k < 5; k++ {
+				got, err := ShamirCombine([][]byte{shares[k], shares[i], shares[j]})
+				if err != nil {
+					t.Errorf("Unable to combine %d %d %d: %v", i, j, k, err)
+				} else {
+					cmpbytes(t, "Shamir", secret, got)
+				}
+			}
+		}
+	}
+
+	if _, err := ShamirCombine(shares[:2]); err == nil {
+		t.Errorf("Combine should fail with too few shares")
+	}
+	if _, err := ShamirCombine([][]byte{shares[0], shares[1], shares[0]}); err == nil {
+		t.Errorf("Combine should fail with duplicate shares")
+	}
+	// a single share is the secret itself
+	single := ensure(ShamirSplit(secret, 1, 1))
+	if got, err := ShamirCombine(single); err != nil || !bytes.Equal(got, secret) {
+		t.Errorf("Unable to combine single share: %v", err)
+	}
+
+	if _, err := ShamirSplit(secret, 2, 3); err == nil {
+		t.Errorf("Split should fail when k > n")
+	}
+}
+
+func TestShareString(t *testing.T) {
+	share := secureRandom(34)
+	str := ShareToString(share)
+
+	got, err := ShareFromString(" " + str + "\n")
+	if err != nil {
+		t.Fatalf("Unable to decode share: %v", err)
+	}
+	if !bytes.Equal(share, got) {
+		t.Errorf("Share changed after encoding")
+	}
+
+	// a typo should be caught by the checksum
+	typo := []byte(str)
+	if typo[0] == 'A' {
+		typo[0] = 'B'
+	} else {
+		typo[0] = 'A'
+	}
+	if _, err := ShareFromString(string(typo)); err == nil {
+		t.Errorf("Share with a typo was accepted")
+	}
+}
@@ -0,0 +1,176 @@
+// Encrypted bundles for sharing entries with another tok user.
+// The bundle is encrypted with an ephemeral X25519 key agreement, the shared
+// secret is passed through HKDF and the entries are encrypted with GCM-AES-256
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+const (
+	SHARE_VERSION uint32 = 2
+	SHARE_INFO           = "tok share bundle"
+)
+
+var (
+	SHARE_MAGIC [4]byte = [4]byte{'t', 'o', 'k', 'S'}
+
+	publicKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// shareHeader represents the share bundle file header
+type shareHeader struct {
+	Magic     [4]byte
+	Version   uint32
+	Ephemeral [32]byte
+	Length    uint32
+}
+
+// GenerateIdentity creates a new X25519 key pair
+func GenerateIdentity() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// PublicKeyToString encodes a public key in a form that is easy to copy & paste
+func PublicKeyToString(pub *ecdh.PublicKey) string {
+	return publicKeyEncoding.EncodeToString(pub.Bytes())
+}
+
+// PublicKeyFromString decodes a public key created by PublicKeyToString
+func PublicKeyFromString(str string) (*ecdh.PublicKey, error) {
+	str = strings.ToUpper(strings.ReplaceAll(str, " ", ""))
+	raw, err := publicKeyEncoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid public key: %v", err)
+	}
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+// agreeKey derives an encryption key from the key agreement between an ephemeral and a recipient key
+func agreeKey(private *ecdh.PrivateKey, public, ephemeral, recipient *ecdh.PublicKey, info string) ([]byte, error) {
+	shared, err := private.ECDH(public)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(ephemeral.Bytes(), recipient.Bytes()...)
+	return HKDF(shared, salt, []byte(info), 32, sha256.New)
+}
+
+// SealBundle encrypts the entries so only the owner of the recipient key can read them
+func SealBundle(recipient *ecdh.PublicKey, entries []*Entry) ([]byte, error) {
+	ephemeral, err := GenerateIdentity()
+	if err != nil {
+		return nil, err
+	}
+	key, err := agreeKey(ephemeral, recipient, ephemeral.PublicKey(), recipient, SHARE_INFO)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. write entries to a plaintext buffer, start with their format and the entry count
+	plain := new(bytes.Buffer)
+	if err := WriteMultiple(plain, BYTE_ORDER, DATABASE_VERSION, uint32(len(entries))); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if err := entry.Serial(plain); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. encrypt it
+	enc, err := encryptBytes(key, plain.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. and add the header
+	hdr := shareHeader{
+		Magic:   SHARE_MAGIC,
+		Version: SHARE_VERSION,
+		Length:  uint32(len(enc)),
+	}
+	copy(hdr.Ephemeral[:], ephemeral.PublicKey().Bytes())
+
+	out := new(bytes.Buffer)
+	if err := binary.Write(out, BYTE_ORDER, &hdr); err != nil {
+		return nil, err
+	}
+	if err := WriteExact(out, enc); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// OpenBundle decrypts a bundle created by SealBundle
+func OpenBundle(identity *ecdh.PrivateKey, data []byte) ([]*Entry, error) {
+	r1 := bytes.NewReader(data)
+
+	// 1. load the header
+	var hdr shareHeader
+	if err := binary.Read(r1, BYTE_ORDER, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Magic != SHARE_MAGIC {
+		return nil, fmt.Errorf("Invalid share bundle")
+	}
+	if hdr.Version < 1 || hdr.Version > SHARE_VERSION {
+		return nil, fmt.Errorf("Invalid share bundle version: %d", hdr.Version)
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(hdr.Ephemeral[:])
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. decrypt the data
+	enc, err := ReadExact(r1, int(hdr.Length))
+	if err != nil {
+		return nil, err
+	}
+	key, err := agreeKey(identity, ephemeral, ephemeral, identity.PublicKey(), SHARE_INFO)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := decryptBytes(key, enc)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decrypt bundle, was it created for someone else?")
+	}
+
+	// 3. read the entries, version 1 did not include their format
+	r2 := bytes.NewBuffer(dec)
+	format := uint32(3)
+	if hdr.Version >= 2 {
+		if err := binary.Read(r2, BYTE_ORDER, &format); err != nil {
+			return nil, err
+		}
+		if format > DATABASE_VERSION {
+			return nil, fmt.Errorf("Share bundle is from a newer version of tok")
+		}
+	}
+
+	var count uint32
+	if err := binary.Read(r2, BYTE_ORDER, &count); err != nil {
+		return nil, err
+	}
+	if count > 1000 {
+		return nil, fmt.Errorf("Too many items in bundle: %d", count)
+	}
+
+	var entries []*Entry
+	for i := 0; i < int(count); i++ {
+		entry := &Entry{}
+		if err := entry.Deserial(r2, format); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPublicKeyString(t *testing.T) {
+	identity := ensure(GenerateIdentity())
+
+	str := PublicKeyToString(identity.PublicKey())
+	pub, err := PublicKeyFromString(str)
+	if err != nil {
+		t.Fatalf("Unable to decode public key: %v", err)
+	}
+	if !pub.Equal(identity.PublicKey()) {
+		t.Errorf("Public key changed after encoding")
+	}
+
+	if _, err := PublicKeyFromString("NOT A KEY"); err == nil {
+		t.Errorf("Invalid public key was accepted")
+	}
+}
+
+func TestShareBundle(t *testing.T) {
+	alice := ensure(GenerateIdentity())
+	bob := ensure(GenerateIdentity())
+
+	db := &Database{}
+	e1 := add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+	e2 := add(db, "entry 2", "M5UXMZJAPFXXKIDVOA")
+
+	bundle, err := SealBundle(bob.PublicKey(), db.Entries)
+	if err != nil {
+		t.Fatalf("Unable to seal bundle: %v", err)
+	}
+
+	entries, err := OpenBundle(bob, bundle)
+	if err != nil {
+		t.Fatalf("Unable to open bundle: %v", err)
+	}
+	if !reflect.DeepEqual(entries, []*Entry{e1, e2}) {
+		t.Errorf("Bundle content changed: %v", entries)
+	}
+
+	if _, err := OpenBundle(alice, bundle); err == nil {
+		t.Errorf("Bundle was opened by the wrong recipient")
+	}
+
+	bundle[len(bundle)-1] ^= 1
+	if _, err := OpenBundle(bob, bundle); err == nil {
+		t.Errorf("Corrupted bundle was opened")
+	}
+}
@@ -0,0 +1,82 @@
+// Steam Guard codes.
+//
+// Steam uses TOTP with SHA-1 and a 30 second period, but the code is 5 symbols
+// from its own alphabet instead of decimal digits. The secret is the base64
+// "shared_secret" from the .maFile created by Steam Desktop Authenticator.
+
+package main
+
+import (
+	"crypto"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	STEAM_ALPHABET = "23456789BCDFGHJKMNPQRTVWXY"
+	STEAM_DIGITS   = 5
+	STEAM_ISSUER   = "Steam"
+)
+
+func init() {
+	RegisterGenerator(ENTRY_STEAM, GeneratorType{
+		Name: "Steam Guard",
+		New: func(e Entry) (Generator, error) {
+			secret, err := secretFromBase64(e.Secret)
+			if err != nil {
+				return nil, err
+			}
+			totp := NewTotp(secret, int(e.Period), int(e.Digits), e.Hash.New)
+			totp.Alphabet = STEAM_ALPHABET
+			return totp, nil
+		},
+		Option:     "steam",
+		Period:     DEFAULT_PERIOD,
+		Digits:     STEAM_DIGITS,
+		Hash:       crypto.SHA1,
+		UriType:    "totp",
+		UriEncoder: "steam",
+	})
+}
+
+// steamFile is the part of a .maFile we care about
+type steamFile struct {
+	SharedSecret string `json:"shared_secret"`
+	AccountName  string `json:"account_name"`
+}
+
+// NewSteamEntry creates a Steam entry from the base64 shared secret
+func NewSteamEntry(name, sharedSecret string) (*Entry, error) {
+	raw, err := base64.StdEncoding.DecodeString(sharedSecret)
+	if err != nil || len(raw) == 0 {
+		return nil, fmt.Errorf("Invalid Steam shared secret")
+	}
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+
+	entry, err := NewTypedEntry(ENTRY_STEAM, name, secret, DEFAULT_HASH, "", "", DEFAULT_PERIOD, DEFAULT_DIGITS)
+	if err != nil {
+		return nil, err
+	}
+	entry.Issuer = STEAM_ISSUER
+	return entry, nil
+}
+
+// EntryFromSteamFile reads a .maFile, the entry is named after the Steam account
+func EntryFromSteamFile(r io.Reader) (*Entry, error) {
+	var file steamFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("Invalid Steam file: %v", err)
+	}
+	if file.SharedSecret == "" {
+		return nil, fmt.Errorf("Invalid Steam file: no shared_secret")
+	}
+
+	name := STEAM_ISSUER
+	if file.AccountName != "" {
+		name = STEAM_ISSUER + ":" + file.AccountName
+	}
+	return NewSteamEntry(name, file.SharedSecret)
+}
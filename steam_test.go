@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSteam(t *testing.T) {
+	// the RFC 6238 secret, codes from the reference implementation in steampy
+	const SHARED_SECRET = "MTIzNDU2Nzg5MDEyMzQ1Njc4OTA="
+
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "PV9M4"},
+		{1111111109, "PY4YB"},
+		{1234567890, "VHHQY"},
+		{2000000000, "9N776"},
+	}
+
+	entry, err := NewSteamEntry("steam", SHARED_SECRET)
+	if err != nil {
+		t.Fatalf("Could not create entry: %v", err)
+	}
+	g := ensure(entry.Generator())
+	for _, test := range tests {
+		if _, code := GenerateCode(g, time.Unix(test.time, 0)); code != test.code {
+			t.Errorf("Steam code at %d: expected %s got %s", test.time, test.code, code)
+		}
+	}
+
+	if _, err := entry.Verify("PY4YB", time.Unix(1111111109, 0), 1); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestSteamImport(t *testing.T) {
+	file := `{"shared_secret": "MTIzNDU2Nzg5MDEyMzQ1Njc4OTA=", "account_name": "gaben", "revocation_code": "R12345"}`
+	entry, err := EntryFromSteamFile(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Could not import: %v", err)
+	}
+	if entry.Name != "Steam:gaben" || entry.Type != ENTRY_STEAM || entry.Digits != STEAM_DIGITS {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	// export to an otpauth URI and back
+	uri := ensure(EntryToUri(entry))
+	if !strings.Contains(uri, "encoder=steam") {
+		t.Errorf("Missing encoder in %s", uri)
+	}
+	e2, err := EntryFromUri(uri)
+	if err != nil || e2.Type != ENTRY_STEAM || e2.Secret != entry.Secret || e2.Digits != STEAM_DIGITS {
+		t.Errorf("Unexpected entry from %s: %+v (%v)", uri, e2, err)
+	}
+
+	// other apps leave out digits and period
+	e3, err := EntryFromUri("otpauth://totp/Steam:gaben?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&issuer=Steam&encoder=steam")
+	if err != nil || e3.Type != ENTRY_STEAM || e3.Digits != STEAM_DIGITS || e3.Period != DEFAULT_PERIOD {
+		t.Errorf("Unexpected entry: %+v (%v)", e3, err)
+	}
+
+	if _, err := EntryFromSteamFile(strings.NewReader(`{"account_name": "gaben"}`)); err == nil {
+		t.Errorf("A file without a secret should fail")
+	}
+}
@@ -0,0 +1,306 @@
+// Database storage formats
+//
+// The single storage keeps the whole database in one encrypted file.
+// The split storage is meant for version control: each entry is encrypted in
+// its own file and only rewritten when it changes, the rest of the database
+// (key slots, list of entries, trash, journal) is kept in an index file.
+// The files are kept in a Store, see store.go
+
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	STORAGE_INDEX_FILE   = "index.tokdb"
+	STORAGE_ENTRIES_DIR  = "entries"
+	STORAGE_ENTRY_SUFFIX = ".tokentry"
+)
+
+// Storage loads and saves a database. Save and Changed should be called with the lock held
+type Storage interface {
+	Load(db *Database, password []byte, identity *ecdh.PrivateKey) error
+	Save(db *Database) error
+	Stat() (StoreInfo, error) // the main file of the database
+	Lock() (unlock func(), err error)
+	Changed() (bool, error) // true if the database was saved by someone else since it was loaded or saved here
+}
+
+// generation remembers the hash of the main file as it was last loaded or saved
+type generation struct {
+	hash []byte
+}
+
+func (g *generation) set(data []byte) {
+	hash := sha256.Sum256(data)
+	g.hash = hash[:]
+}
+
+func (g *generation) changed(store Store, name string) (bool, error) {
+	data, err := store.Read(name)
+	if os.IsNotExist(err) {
+		return g.hash != nil, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	hash := sha256.Sum256(data)
+	return !bytes.Equal(g.hash, hash[:]), nil
+}
+
+// OpenStorage returns the storage for a path, a split storage in a directory if
+// the path is a directory or ends with a slash and a single file otherwise
+func OpenStorage(filename string) Storage {
+	if strings.HasSuffix(filename, "/") {
+		return newSplitStorage(&dirStore{dir: filename})
+	}
+	if info, err := os.Stat(filename); err == nil && info.IsDir() {
+		return newSplitStorage(&dirStore{dir: filename})
+	}
+	return &singleStorage{store: &fileStore{filename: filename}}
+}
+
+// singleStorage keeps the database in a single file
+type singleStorage struct {
+	generation
+	store Store
+}
+
+func (s *singleStorage) Load(db *Database, password []byte, identity *ecdh.PrivateKey) error {
+	data, err := s.store.Read(STORE_DATABASE)
+	if err != nil {
+		return err
+	}
+
+	c, err := readContainer(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err := db.open(c, password, identity, readInlineEntries); err != nil {
+		return err
+	}
+	s.set(data)
+	return nil
+}
+
+func (s *singleStorage) Save(db *Database) error {
+	enc, err := db.seal(writeInlineEntries)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	if err := writeContainer(buf, db.Slots, enc); err != nil {
+		return err
+	}
+	if err := s.store.Write(STORE_DATABASE, buf.Bytes()); err != nil {
+		return err
+	}
+	s.set(buf.Bytes())
+	return nil
+}
+
+func (s *singleStorage) Stat() (StoreInfo, error) {
+	return s.store.Stat(STORE_DATABASE)
+}
+
+func (s *singleStorage) Lock() (func(), error) {
+	return s.store.Lock()
+}
+
+func (s *singleStorage) Changed() (bool, error) {
+	return s.changed(s.store, STORE_DATABASE)
+}
+
+// splitStorage keeps the database in an index and one file per entry
+type splitStorage struct {
+	generation
+	store   Store
+	key     []byte            // the key the entry files were written with
+	written map[string][]byte // hash of the plaintext of each entry file, by id
+}
+
+func newSplitStorage(store Store) *splitStorage {
+	return &splitStorage{store: store, written: map[string][]byte{}}
+}
+
+func (s *splitStorage) entryFile(id string) (string, error) {
+	if raw, err := hex.DecodeString(id); err != nil || len(raw) != ENTRY_ID_SIZE {
+		return "", fmt.Errorf("Invalid entry id: '%s'", id)
+	}
+	return path.Join(STORAGE_ENTRIES_DIR, id+STORAGE_ENTRY_SUFFIX), nil
+}
+
+func (s *splitStorage) Load(db *Database, password []byte, identity *ecdh.PrivateKey) error {
+	data, err := s.store.Read(STORAGE_INDEX_FILE)
+	if err != nil {
+		return err
+	}
+
+	c, err := readContainer(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err := db.open(c, password, identity, s.readEntries); err != nil {
+		return err
+	}
+	s.key = db.key
+	s.set(data)
+	return nil
+}
+
+func (s *splitStorage) Stat() (StoreInfo, error) {
+	return s.store.Stat(STORAGE_INDEX_FILE)
+}
+
+func (s *splitStorage) Lock() (func(), error) {
+	return s.store.Lock()
+}
+
+func (s *splitStorage) Changed() (bool, error) {
+	return s.changed(s.store, STORAGE_INDEX_FILE)
+}
+
+// readEntries reads the list of ids from the index and then the entry files
+func (s *splitStorage) readEntries(r io.Reader, version uint32, key []byte) ([]*Entry, error) {
+	var ids []string
+	if err := ReadOne(r, BYTE_ORDER, &ids); err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, id := range ids {
+		filename, err := s.entryFile(id)
+		if err != nil {
+			return nil, err
+		}
+		enc, err := s.store.Read(filename)
+		if err != nil {
+			return nil, err
+		}
+		plain, err := decryptBytes(key, enc)
+		if err != nil {
+			return nil, fmt.Errorf("Unable to decrypt %s: %v", filename, err)
+		}
+
+		var entryVersion uint32
+		r2 := bytes.NewBuffer(plain)
+		if err := ReadOne(r2, BYTE_ORDER, &entryVersion); err != nil {
+			return nil, err
+		}
+		if entryVersion < 1 || entryVersion > DATABASE_VERSION {
+			return nil, fmt.Errorf("Invalid entry version in %s: %d", filename, entryVersion)
+		}
+		entry := &Entry{}
+		if err := entry.Deserial(r2, entryVersion); err != nil {
+			return nil, err
+		}
+		if entry.Id != id {
+			return nil, fmt.Errorf("Entry in %s has the wrong id", filename)
+		}
+		entries = append(entries, entry)
+
+		// old versions are rewritten on the next save
+		if entryVersion == DATABASE_VERSION {
+			hash := sha256.Sum256(plain)
+			s.written[id] = hash[:]
+		}
+	}
+	return entries, nil
+}
+
+// Save writes the changed entry files, then the index and finally removes the
+// files of entries that are no longer in the database
+func (s *splitStorage) Save(db *Database) error {
+	// all entries are encrypted again when the key changes, e.g. after 'members rm'
+	if !bytes.Equal(s.key, db.key) {
+		s.written = map[string][]byte{}
+	}
+
+	ids := make([]string, len(db.Entries))
+	for i, entry := range db.Entries {
+		ids[i] = entry.Id
+		if err := s.writeEntry(db.key, entry); err != nil {
+			return err
+		}
+	}
+
+	enc, err := db.seal(func(w io.Writer, entries []*Entry) error {
+		return WriteOne(w, BYTE_ORDER, ids)
+	})
+	if err != nil {
+		return err
+	}
+	index := new(bytes.Buffer)
+	if err := writeContainer(index, db.Slots, enc); err != nil {
+		return err
+	}
+	if err := s.store.Write(STORAGE_INDEX_FILE, index.Bytes()); err != nil {
+		return err
+	}
+	s.key = db.key
+	s.set(index.Bytes())
+
+	return s.removeStale(ids)
+}
+
+// writeEntry writes an entry file, unless the entry is unchanged since it was last read or written
+func (s *splitStorage) writeEntry(key []byte, entry *Entry) error {
+	filename, err := s.entryFile(entry.Id)
+	if err != nil {
+		return err
+	}
+
+	plain := new(bytes.Buffer)
+	if err := WriteOne(plain, BYTE_ORDER, DATABASE_VERSION); err != nil {
+		return err
+	}
+	if err := entry.Serial(plain); err != nil {
+		return err
+	}
+	hash := sha256.Sum256(plain.Bytes())
+	if bytes.Equal(s.written[entry.Id], hash[:]) {
+		return nil
+	}
+
+	enc, err := encryptBytes(key, plain.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := s.store.Write(filename, enc); err != nil {
+		return err
+	}
+	s.written[entry.Id] = hash[:]
+	return nil
+}
+
+// removeStale removes the entry files that are not in the list of ids
+func (s *splitStorage) removeStale(ids []string) error {
+	files, err := s.store.List(STORAGE_ENTRIES_DIR)
+	if err != nil {
+		return err
+	}
+
+	keep := map[string]bool{}
+	for _, id := range ids {
+		keep[id] = true
+	}
+	for _, file := range files {
+		id, ok := strings.CutSuffix(file, STORAGE_ENTRY_SUFFIX)
+		if ok && !keep[id] {
+			if err := s.store.Remove(path.Join(STORAGE_ENTRIES_DIR, file)); err != nil {
+				return err
+			}
+			delete(s.written, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitStorage(t *testing.T) {
+	dir := t.TempDir() + "/vault/"
+	db1 := ensure(CreateDatabase(dir, "password"))
+	e1 := add(db1, "entry 1", "NZSXMZLSEBTW63TOME")
+	e1.Tags = []string{"prod"}
+	e2 := add(db1, "entry 2", "M5UXMZJAPFXXKIDVOA")
+	if err := db1.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	db2 := ensure(LoadDatabase(dir, "password"))
+	if !reflect.DeepEqual(db2.Entries, db1.Entries) {
+		t.Fatalf("Loaded entries differ: %v vs %v", db2.Entries, db1.Entries)
+	}
+
+	// only the changed entry file is written again
+	file1 := filepath.Join(dir, STORAGE_ENTRIES_DIR, e1.Id+STORAGE_ENTRY_SUFFIX)
+	file2 := filepath.Join(dir, STORAGE_ENTRIES_DIR, e2.Id+STORAGE_ENTRY_SUFFIX)
+	data1, data2 := ensure(os.ReadFile(file1)), ensure(os.ReadFile(file2))
+	note := "changed"
+	if err := db2.Edit(db2.Entries[1], EntryChanges{Note: &note}); err != nil {
+		t.Fatalf("Edit failed: %v", err)
+	}
+	if err := db2.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+	cmpbytes(t, "Unchanged entry file", data1, ensure(os.ReadFile(file1)))
+	if reflect.DeepEqual(data2, ensure(os.ReadFile(file2))) {
+		t.Errorf("Changed entry file was not written")
+	}
+
+	// removed entries are removed from the directory
+	db2.Delete(db2.Entries[0])
+	if err := db2.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+	if _, err := os.Stat(file1); !os.IsNotExist(err) {
+		t.Errorf("Entry file of removed entry was kept: %v", err)
+	}
+	db3 := ensure(LoadDatabase(dir, "password"))
+	if len(db3.Entries) != 1 || db3.Entries[0].Note != "changed" || len(db3.Trash) != 1 {
+		t.Errorf("Wrong entries after removal: %v %v", db3.Entries, db3.Trash)
+	}
+}
+
+func TestSplitStorageInvalidId(t *testing.T) {
+	s := newSplitStorage(newMemStore())
+	for _, id := range []string{"", "../../etc/passwd", "0011223344556677aa"} {
+		if _, err := s.entryFile(id); err == nil {
+			t.Errorf("Invalid id '%s' was accepted", id)
+		}
+	}
+}
+
+func TestStorageConcurrentSaves(t *testing.T) {
+	dir := t.TempDir()
+	for _, filename := range []string{dir + "/test.tokdb", dir + "/vault/"} {
+		db := ensure(CreateDatabase(filename, "password"))
+		add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+		ensure(0, db.Save())
+
+		// two processes open the database, the second one to save must not overwrite the first
+		db1 := ensure(LoadDatabase(filename, "password"))
+		db2 := ensure(LoadDatabase(filename, "password"))
+		add(db1, "entry 2", "M5UXMZJAPFXXKIDVOA")
+		ensure(0, db1.Save())
+		add(db2, "entry 3", "GEZDGNBVGY3TQOJQ")
+		if err := db2.Save(); err == nil {
+			t.Errorf("%s: stale database was saved", filename)
+		}
+
+		// Update loads the changes first
+		err := db2.Update(func() error {
+			add(db2, "entry 3", "GEZDGNBVGY3TQOJQ")
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("%s: update failed: %v", filename, err)
+		}
+		db3 := ensure(LoadDatabase(filename, "password"))
+		if len(db3.Entries) != 3 {
+			t.Errorf("%s: changes were lost: %v", filename, db3.Entries)
+		}
+
+		// a second save after Update is not stale
+		ensure(0, db2.Save())
+	}
+}
@@ -0,0 +1,301 @@
+// Where the bytes of a database are kept
+//
+// A Store holds named files, the storage formats in storage.go decide what goes
+// in them. The file store is a single database file, the directory store keeps
+// any number of files below a directory and the memory store is used in tests.
+
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	STORE_DATABASE  = "database" // the only file in a file store
+	STORE_LOCK_FILE = "tok.lock"
+
+	XDG_DATABASE_DIR  = "tok"
+	XDG_DATABASE_FILE = "tok.tokdb"
+)
+
+// Store keeps the files of a database, names are slash separated paths
+type Store interface {
+	Read(name string) ([]byte, error)
+	Write(name string, data []byte) error // replaces the file, or leaves the old one if it fails
+	Remove(name string) error
+	List(dir string) ([]string, error) // the names of the files in a directory
+	Stat(name string) (StoreInfo, error)
+	Lock() (unlock func(), err error) // fails if the store is already locked
+}
+
+// StoreInfo is what Stat knows about a file
+type StoreInfo struct {
+	Size     int64
+	Modified time.Time
+}
+
+// notExist returns the same kind of error as os.Open for a missing file
+func notExist(op, name string) error {
+	return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+}
+
+// writeFile writes to a temporary file and then renames it, so that a failed
+// write doesn't leave a partial file. A symlink is followed, not replaced
+func writeFile(filename string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(filename); err == nil {
+		filename = target
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func statFile(filename string) (StoreInfo, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return StoreInfo{}, err
+	}
+	return StoreInfo{Size: info.Size(), Modified: info.ModTime()}, nil
+}
+
+// lockFile creates a lock file, it is removed by unlock
+func lockFile(filename string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("Database is in use, remove %s if it is not", filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return func() { os.Remove(filename) }, nil
+}
+
+// fileStore is a database in a single file
+type fileStore struct {
+	filename string
+}
+
+func (s *fileStore) check(name string) error {
+	if name != STORE_DATABASE {
+		return fmt.Errorf("%s is a single file and can't hold '%s'", s.filename, name)
+	}
+	return nil
+}
+
+func (s *fileStore) Read(name string) ([]byte, error) {
+	if err := s.check(name); err != nil {
+		return nil, err
+	}
+	return os.ReadFile(s.filename)
+}
+
+func (s *fileStore) Write(name string, data []byte) error {
+	if err := s.check(name); err != nil {
+		return err
+	}
+	return writeFile(s.filename, data)
+}
+
+func (s *fileStore) Remove(name string) error {
+	if err := s.check(name); err != nil {
+		return err
+	}
+	return os.Remove(s.filename)
+}
+
+func (s *fileStore) List(dir string) ([]string, error) {
+	return nil, nil
+}
+
+func (s *fileStore) Stat(name string) (StoreInfo, error) {
+	if err := s.check(name); err != nil {
+		return StoreInfo{}, err
+	}
+	return statFile(s.filename)
+}
+
+func (s *fileStore) Lock() (func(), error) {
+	return lockFile(s.filename + ".lock")
+}
+
+// dirStore keeps the files below a directory
+type dirStore struct {
+	dir string
+}
+
+// path returns the file for a name, names can't point outside the directory
+func (s *dirStore) path(name string) (string, error) {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("Invalid file name '%s'", name)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)), nil
+}
+
+func (s *dirStore) Read(name string) ([]byte, error) {
+	filename, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(filename)
+}
+
+func (s *dirStore) Write(name string, data []byte) error {
+	filename, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return writeFile(filename, data)
+}
+
+func (s *dirStore) Remove(name string) error {
+	filename, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(filename)
+}
+
+func (s *dirStore) List(dir string) ([]string, error) {
+	filename, err := s.path(dir)
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, f := range files {
+		if f.Type().IsRegular() {
+			ret = append(ret, f.Name())
+		}
+	}
+	return ret, nil
+}
+
+func (s *dirStore) Stat(name string) (StoreInfo, error) {
+	filename, err := s.path(name)
+	if err != nil {
+		return StoreInfo{}, err
+	}
+	return statFile(filename)
+}
+
+func (s *dirStore) Lock() (func(), error) {
+	return lockFile(filepath.Join(s.dir, STORE_LOCK_FILE))
+}
+
+// memStore keeps the files in memory
+type memStore struct {
+	mutex  sync.Mutex
+	files  map[string][]byte
+	times  map[string]time.Time
+	locked bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{files: map[string][]byte{}, times: map[string]time.Time{}}
+}
+
+func (s *memStore) Read(name string) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.files[name]
+	if !ok {
+		return nil, notExist("open", name)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *memStore) Write(name string, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.files[name] = append([]byte(nil), data...)
+	s.times[name] = time.Now()
+	return nil
+}
+
+func (s *memStore) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, ok := s.files[name]; !ok {
+		return notExist("remove", name)
+	}
+	delete(s.files, name)
+	delete(s.times, name)
+	return nil
+}
+
+func (s *memStore) List(dir string) ([]string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var ret []string
+	for name := range s.files {
+		if d, base := path.Split(name); path.Clean(d) == path.Clean(dir) {
+			ret = append(ret, base)
+		}
+	}
+	sort.Strings(ret)
+	return ret, nil
+}
+
+func (s *memStore) Stat(name string) (StoreInfo, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	data, ok := s.files[name]
+	if !ok {
+		return StoreInfo{}, notExist("stat", name)
+	}
+	return StoreInfo{Size: int64(len(data)), Modified: s.times[name]}, nil
+}
+
+func (s *memStore) Lock() (func(), error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.locked {
+		return nil, fmt.Errorf("Database is in use")
+	}
+	s.locked = true
+	return func() {
+		s.mutex.Lock()
+		s.locked = false
+		s.mutex.Unlock()
+	}, nil
+}
+
+// DefaultDatabasePath returns the database in the XDG data directory, or the
+// old ~/.tokdb if there is one
+func DefaultDatabasePath(home string) string {
+	old := filepath.Join(home, DATABASE_FILENAME)
+	if _, err := os.Stat(old); err == nil {
+		return old
+	}
+
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" || !filepath.IsAbs(data) {
+		data = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(data, XDG_DATABASE_DIR, XDG_DATABASE_FILE)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	dir := t.TempDir()
+	stores := map[string]Store{
+		"memory":    newMemStore(),
+		"directory": &dirStore{dir: dir + "/vault"},
+	}
+	for kind, store := range stores {
+		if _, err := store.Read("entries/a"); !os.IsNotExist(err) {
+			t.Errorf("%s: missing file gave wrong error: %v", kind, err)
+		}
+		ensure(0, store.Write("entries/a", []byte("first")))
+		ensure(0, store.Write("entries/a", []byte("second")))
+		ensure(0, store.Write("index", []byte("index")))
+		if data, err := store.Read("entries/a"); err != nil || string(data) != "second" {
+			t.Errorf("%s: wrong data: '%s' %v", kind, data, err)
+		}
+		if info, err := store.Stat("entries/a"); err != nil || info.Size != 6 {
+			t.Errorf("%s: wrong stat: %v %v", kind, info, err)
+		}
+		if files := ensure(store.List("entries")); !reflect.DeepEqual(files, []string{"a"}) {
+			t.Errorf("%s: wrong files: %v", kind, files)
+		}
+		ensure(0, store.Remove("entries/a"))
+		if _, err := store.Stat("entries/a"); !os.IsNotExist(err) {
+			t.Errorf("%s: file was not removed: %v", kind, err)
+		}
+
+		unlock := ensure(store.Lock())
+		if _, err := store.Lock(); err == nil {
+			t.Errorf("%s: locked twice", kind)
+		}
+		unlock()
+		ensure(store.Lock())()
+	}
+
+	// names can't point outside of the directory
+	for _, name := range []string{"", "../a", "/a", "a/../../b", "./a"} {
+		if err := stores["directory"].Write(name, nil); err == nil {
+			t.Errorf("Invalid name '%s' was accepted", name)
+		}
+	}
+
+	file := &fileStore{filename: dir + "/sub/test.tokdb"}
+	ensure(0, file.Write(STORE_DATABASE, []byte("data")))
+	if data := ensure(os.ReadFile(dir + "/sub/test.tokdb")); string(data) != "data" {
+		t.Errorf("Wrong file data: '%s'", data)
+	}
+	if err := file.Write("entries/a", nil); err == nil {
+		t.Errorf("File store accepted a second file")
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	for _, storage := range []Storage{&singleStorage{store: newMemStore()}, newSplitStorage(newMemStore())} {
+		db1 := ensure(CreateDatabaseInStorage(storage, "password"))
+		add(db1, "entry 1", "NZSXMZLSEBTW63TOME")
+		if err := db1.Save(); err != nil {
+			t.Fatalf("Unable to save database: %v", err)
+		}
+		db2 := ensure(LoadDatabaseFromStorage(storage, "password"))
+		if !reflect.DeepEqual(db2.Entries, db1.Entries) {
+			t.Errorf("Loaded entries differ: %v vs %v", db2.Entries, db1.Entries)
+		}
+	}
+}
+
+func TestStorageMigrate(t *testing.T) {
+	// a version 2 database, the content key is derived from the password
+	salt := secureRandom(PASSWORD_SALT_SIZE)
+	plain := new(bytes.Buffer)
+	ensure(0, WriteMultiple(plain, BYTE_ORDER, uint32(1),
+		int64(1000), uint16(30), uint8(6), uint64(crypto.SHA1), "old", "NZSXMZLSEBTW63TOME", "note",
+		[]byte(nil)))
+	enc := ensure(encryptBytes(GenerateKeyFromPassword([]byte("password"), salt), plain.Bytes()))
+
+	legacy := legacyHeader{Length: uint32(len(enc))}
+	copy(legacy.PasswordSalt[:], salt)
+	file := new(bytes.Buffer)
+	binary.Write(file, BYTE_ORDER, databaseHeader{Magic: DATABASE_MAGIC, Version: 2})
+	binary.Write(file, BYTE_ORDER, legacy)
+	file.Write(enc)
+
+	store := newMemStore()
+	ensure(0, store.Write(STORE_DATABASE, file.Bytes()))
+	storage := &singleStorage{store: store}
+
+	db1 := ensure(LoadDatabaseFromStorage(storage, "password"))
+	if len(db1.Entries) != 1 || db1.Entries[0].Name != "old" || db1.Entries[0].Id == "" || len(db1.Slots) != 1 {
+		t.Fatalf("Wrong migrated database: %v %v", db1.Entries, db1.Slots)
+	}
+	if err := db1.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	var hdr databaseHeader
+	binary.Read(bytes.NewReader(ensure(store.Read(STORE_DATABASE))), BYTE_ORDER, &hdr)
+	if hdr.Version != DATABASE_VERSION {
+		t.Errorf("Saved with version %d", hdr.Version)
+	}
+	db2 := ensure(LoadDatabaseFromStorage(storage, "password"))
+	if !reflect.DeepEqual(db2.Entries, db1.Entries) {
+		t.Errorf("Loaded entries differ: %v vs %v", db2.Entries, db1.Entries)
+	}
+}
+
+func TestDefaultDatabasePath(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", "")
+	if p := DefaultDatabasePath(home); p != filepath.Join(home, ".local/share/tok/tok.tokdb") {
+		t.Errorf("Wrong default path: %s", p)
+	}
+	t.Setenv("XDG_DATA_HOME", "/data")
+	if p := DefaultDatabasePath(home); p != "/data/tok/tok.tokdb" {
+		t.Errorf("Wrong path with XDG_DATA_HOME: %s", p)
+	}
+
+	// an existing database in the old place is still used
+	ensure(0, os.WriteFile(filepath.Join(home, DATABASE_FILENAME), nil, 0600))
+	if p := DefaultDatabasePath(home); p != filepath.Join(home, DATABASE_FILENAME) {
+		t.Errorf("Old database was not used: %s", p)
+	}
+}
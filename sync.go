@@ -0,0 +1,241 @@
+// Merging two copies of a database
+//
+// Entries are matched by id, or by secret if the copies were created separately.
+// Removals are only matched by id.
+// When both copies changed an entry the most recent change wins, and removed
+// entries are matched against the trash and the tombstones of purged entries so
+// that a removal is only undone by a later change. Counters never go backwards.
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+type SyncAction int
+
+const (
+	SYNC_ADD SyncAction = iota
+	SYNC_UPDATE
+	SYNC_REMOVE
+	SYNC_RESTORE
+)
+
+// SyncChange is a change to the local database planned by PlanSync
+type SyncChange struct {
+	Action  SyncAction
+	Local   *Entry     // the local entry, or the trashed one for SYNC_RESTORE. nil for SYNC_ADD
+	Other   *Entry     // the entry from the other database, nil for SYNC_REMOVE
+	Deleted int64      // when the entry was removed in the other database, for SYNC_REMOVE
+	Fields  []string   // the fields that change
+	item    *TrashItem // the local trash item for SYNC_RESTORE
+}
+
+func (c SyncChange) String() string {
+	switch c.Action {
+	case SYNC_ADD:
+		return fmt.Sprintf("+ %s", c.Other.Name)
+	case SYNC_UPDATE:
+		return fmt.Sprintf("~ %s (%s)", c.Local.Name, strings.Join(c.Fields, ", "))
+	case SYNC_REMOVE:
+		return fmt.Sprintf("- %s", c.Local.Name)
+	default:
+		return fmt.Sprintf("+ %s (restored from trash)", c.Other.Name)
+	}
+}
+
+// entryDiff lists the fields that differ, apart from id, counter and times
+func entryDiff(a, b *Entry) []string {
+	var ret []string
+	check := func(name string, x, y any) {
+		if !reflect.DeepEqual(x, y) {
+			ret = append(ret, name)
+		}
+	}
+	check("name", a.Name, b.Name)
+	check("secret", a.Secret, b.Secret)
+	check("note", a.Note, b.Note)
+	check("issuer", a.Issuer, b.Issuer)
+	check("folder", a.Folder, b.Folder)
+	check("tags", strings.Join(a.Tags, ","), strings.Join(b.Tags, ","))
+	check("pin", a.Pin, b.Pin)
+	check("type", a.Type+a.Suite, b.Type+b.Suite)
+	check("parameters", []any{a.Hash, a.Period, a.Digits}, []any{b.Hash, b.Period, b.Digits})
+	return ret
+}
+
+// findSyncMatch finds the local entry with the same id, or else the same secret
+func findSyncMatch(entries []*Entry, other *Entry) *Entry {
+	for _, e := range entries {
+		if e.Id == other.Id {
+			return e
+		}
+	}
+	db := Database{Entries: entries}
+	return db.findSecret(other.Secret)
+}
+
+// PlanSync compares the database with another copy and returns the changes
+// needed to bring in the changes made in the other copy
+func (db *Database) PlanSync(other *Database) []SyncChange {
+	var changes []SyncChange
+
+	trashed := make([]*Entry, len(db.Trash))
+	for i, item := range db.Trash {
+		trashed[i] = item.Entry
+	}
+
+	for _, o := range other.Entries {
+		if l := findSyncMatch(db.Entries, o); l != nil {
+			fields := entryDiff(l, o)
+			if o.Modified <= l.Modified {
+				fields = nil
+			}
+			if o.Counter > l.Counter {
+				fields = append(fields, "counter")
+			}
+			if len(fields) != 0 {
+				changes = append(changes, SyncChange{Action: SYNC_UPDATE, Local: l, Other: o, Fields: fields})
+			}
+			continue
+		}
+
+		// removed here, only a later change in the other copy brings it back
+		if l := findSyncMatch(trashed, o); l != nil {
+			for _, item := range db.Trash {
+				if item.Entry == l && o.Modified > item.Deleted {
+					changes = append(changes, SyncChange{Action: SYNC_RESTORE, Local: l, Other: o, item: item})
+				}
+			}
+			continue
+		}
+		if t := db.findTombstone(o.Id); t != nil {
+			if o.Modified > t.Deleted {
+				changes = append(changes, SyncChange{Action: SYNC_ADD, Other: o})
+			}
+			continue
+		}
+		changes = append(changes, SyncChange{Action: SYNC_ADD, Other: o})
+	}
+
+	// entries removed in the other copy after the last local change. Only the id is
+	// used here, the secret of a removed entry may have been added again as a new entry
+	removed := func(id string, deleted int64) {
+		for _, l := range db.Entries {
+			if l.Id != id || deleted <= l.Modified {
+				continue
+			}
+			for _, c := range changes {
+				if c.Local == l {
+					return
+				}
+			}
+			changes = append(changes, SyncChange{Action: SYNC_REMOVE, Local: l, Deleted: deleted})
+		}
+	}
+	for _, item := range other.Trash {
+		removed(item.Entry.Id, item.Deleted)
+	}
+	for _, t := range other.Tombstones {
+		removed(t.Id, t.Deleted)
+	}
+	return changes
+}
+
+// ApplySync makes the changes from PlanSync (but doesn't save them). The tombstones
+// of the other copy are also kept, so that the entries stay purged
+func (db *Database) ApplySync(other *Database, changes []SyncChange) error {
+	// removals go first, so that they make room for the added entries
+	var ordered []SyncChange
+	added := 0
+	for _, c := range changes {
+		switch c.Action {
+		case SYNC_ADD, SYNC_RESTORE:
+			added++
+		case SYNC_REMOVE:
+			added--
+			ordered = append(ordered, c)
+		}
+	}
+	if err := db.checkRoom(added); err != nil {
+		return err
+	}
+	for _, c := range changes {
+		if c.Action != SYNC_REMOVE {
+			ordered = append(ordered, c)
+		}
+	}
+
+	for _, c := range ordered {
+		switch c.Action {
+		case SYNC_ADD:
+			e := *c.Other
+			e.Tags = append([]string(nil), c.Other.Tags...)
+			e.Name = db.freeName(e.Name, nil)
+			if err := db.Add(&e); err != nil {
+				return err
+			}
+
+		case SYNC_UPDATE:
+			counter := c.Local.Counter
+			if c.Other.Counter > counter {
+				counter = c.Other.Counter
+			}
+			if c.Other.Modified > c.Local.Modified {
+				id := c.Local.Id
+				*c.Local = *c.Other
+				c.Local.Id = id
+				c.Local.Tags = append([]string(nil), c.Other.Tags...)
+				c.Local.Name = db.freeName(c.Local.Name, c.Local)
+			}
+			c.Local.Counter = counter
+			db.Record(JOURNAL_MERGE, c.Local)
+
+		case SYNC_REMOVE:
+			if err := db.Delete(c.Local); err != nil {
+				return err
+			}
+			db.Trash[len(db.Trash)-1].Deleted = c.Deleted
+
+		case SYNC_RESTORE:
+			id := c.Local.Id
+			*c.Local = *c.Other
+			c.Local.Id = id
+			c.Local.Tags = append([]string(nil), c.Other.Tags...)
+			c.Local.Name = db.freeName(c.Local.Name, c.Local)
+			if err := db.Restore(c.item); err != nil {
+				return err
+			}
+			c.Local.Modified = c.Other.Modified
+		}
+	}
+
+	for _, t := range other.Tombstones {
+		if db.findTombstone(t.Id) == nil {
+			db.addTombstone(t)
+		}
+	}
+	return nil
+}
+
+// freeName returns the name, or the name with a number if another entry uses it
+func (db Database) freeName(name string, entry *Entry) string {
+	ret := name
+	for i := 2; ; i++ {
+		if e := db.findExact(ret); e == nil || e == entry {
+			return ret
+		}
+		ret = fmt.Sprintf("%s (%d)", name, i)
+	}
+}
+
+func (db Database) findTombstone(id string) *Tombstone {
+	for i, t := range db.Tombstones {
+		if t.Id == id {
+			return &db.Tombstones[i]
+		}
+	}
+	return nil
+}
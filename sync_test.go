@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// copyDatabase returns a second copy of the entries, like a database file copied to another computer
+func copyDatabase(db *Database) *Database {
+	other := &Database{}
+	for _, e := range db.Entries {
+		c := *e
+		other.Entries = append(other.Entries, &c)
+	}
+	return other
+}
+
+func syncActions(changes []SyncChange) []SyncAction {
+	var ret []SyncAction
+	for _, c := range changes {
+		ret = append(ret, c.Action)
+	}
+	return ret
+}
+
+func TestSyncChanges(t *testing.T) {
+	local := &Database{}
+	e1 := add(local, "entry 1", "NZSXMZLSEBTW63TOME")
+	e2 := add(local, "entry 2", "M5UXMZJAPFXXKIDVOA")
+	e3 := add(local, "entry 3", "GEZDGNBVGY3TQOJQ")
+	other := copyDatabase(local)
+
+	if changes := local.PlanSync(other); len(changes) != 0 {
+		t.Fatalf("Identical copies have changes: %v", changes)
+	}
+
+	// newer note and a higher counter in the other copy, older note is ignored
+	other.Entries[0].Note, other.Entries[0].Modified = "new note", e1.Modified+1
+	other.Entries[1].Note, other.Entries[1].Modified = "old note", e2.Modified-1
+	other.Entries[1].Counter = 5
+	// removed in the other copy, and a new entry
+	other.Trash = []*TrashItem{{Entry: other.Entries[2], Deleted: e3.Modified + 1}}
+	other.Entries = other.Entries[:2]
+	e4 := add(other, "entry 4", "GEZDGNBVGY3TQOJQGEZA")
+
+	changes := local.PlanSync(other)
+	want := []SyncAction{SYNC_UPDATE, SYNC_UPDATE, SYNC_ADD, SYNC_REMOVE}
+	if got := syncActions(changes); len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] || got[3] != want[3] {
+		t.Fatalf("Wrong changes: %v", changes)
+	}
+	if err := local.ApplySync(other, changes); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if e1.Note != "new note" || e2.Note != "" || e2.Counter != 5 {
+		t.Errorf("Entries were not updated: %v %v", e1, e2)
+	}
+	if len(local.Entries) != 3 || local.Entries[2].Id != e4.Id || len(local.Trash) != 1 || local.Trash[0].Entry != e3 {
+		t.Errorf("Entries were not added or removed: %v %v", local.Entries, local.Trash)
+	}
+	if changes := local.PlanSync(other); len(changes) != 0 {
+		t.Errorf("Second sync has changes: %v", changes)
+	}
+}
+
+func TestSyncRemovals(t *testing.T) {
+	local := &Database{TrashDays: TRASH_DEFAULT_DAYS}
+	e1 := add(local, "entry 1", "NZSXMZLSEBTW63TOME")
+	e2 := add(local, "entry 2", "M5UXMZJAPFXXKIDVOA")
+	e3 := add(local, "entry 3", "GEZDGNBVGY3TQOJQ")
+	other := copyDatabase(local)
+
+	// removed and purged here, changed there before the removal
+	local.Delete(e1)
+	local.PurgeAll()
+	other.Entries[0].Modified = local.Tombstones[0].Deleted - 1
+
+	// removed here, changed there after the removal
+	local.Delete(e2)
+	other.Entries[1].Note, other.Entries[1].Modified = "changed", local.Trash[0].Deleted+1
+
+	// removed there, changed here after the removal
+	other.Tombstones = []Tombstone{{Id: e3.Id, Deleted: e3.Modified - 1}}
+	other.Entries = other.Entries[:2]
+
+	changes := local.PlanSync(other)
+	if len(changes) != 1 || changes[0].Action != SYNC_RESTORE || changes[0].Local != e2 {
+		t.Fatalf("Wrong changes: %v", changes)
+	}
+	if err := local.ApplySync(other, changes); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(local.Entries) != 2 || local.Entries[1] != e2 || e2.Note != "changed" || len(local.Trash) != 0 {
+		t.Errorf("Entry was not restored: %v", local.Entries)
+	}
+	if local.findTombstone(e3.Id) == nil {
+		t.Errorf("Tombstone was not copied")
+	}
+}
+
+func TestSyncNames(t *testing.T) {
+	local := &Database{}
+	add(local, "entry", "NZSXMZLSEBTW63TOME")
+	other := &Database{}
+	add(other, "entry", "M5UXMZJAPFXXKIDVOA")
+	// the same secret, created separately
+	same := add(other, "same", "NZSXMZLSEBTW63TOME")
+	same.Modified = 0
+
+	changes := local.PlanSync(other)
+	if len(changes) != 1 || changes[0].Action != SYNC_ADD {
+		t.Fatalf("Wrong changes: %v", changes)
+	}
+	if err := local.ApplySync(other, changes); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(local.Entries) != 2 || local.Entries[1].Name != "entry (2)" {
+		t.Errorf("Name conflict was not resolved: %v", local.Entries)
+	}
+}
+
+func TestSyncRestored(t *testing.T) {
+	a := &Database{TrashDays: TRASH_DEFAULT_DAYS}
+	e1 := add(a, "entry 1", "NZSXMZLSEBTW63TOME")
+	add(a, "entry 2", "M5UXMZJAPFXXKIDVOA")
+	b := copyDatabase(a)
+
+	// removed in a and merged into b, then restored in a
+	a.Delete(e1)
+	if err := b.ApplySync(a, b.PlanSync(a)); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(b.Entries) != 1 || len(b.Trash) != 1 {
+		t.Fatalf("Entry was not removed: %v", b.Entries)
+	}
+	time.Sleep(time.Millisecond)
+	if err := a.Restore(a.Trash[0]); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	// the removal in b is older than the restore
+	if changes := a.PlanSync(b); len(changes) != 0 {
+		t.Errorf("Restored entry is removed again: %v", changes)
+	}
+	changes := b.PlanSync(a)
+	if len(changes) != 1 || changes[0].Action != SYNC_RESTORE {
+		t.Fatalf("Wrong changes: %v", changes)
+	}
+	if err := b.ApplySync(a, changes); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if len(b.Entries) != 2 || len(b.Trash) != 0 || b.Entries[1].Modified != e1.Modified {
+		t.Errorf("Entry was not restored: %v %v", b.Entries, b.Trash)
+	}
+}
@@ -10,11 +10,29 @@ import (
 	"time"
 )
 
+func init() {
+	RegisterGenerator(ENTRY_TOTP, GeneratorType{
+		Name: "TOTP",
+		New: func(e Entry) (Generator, error) {
+			secret, err := secretFromBase64(e.Secret)
+			if err != nil {
+				return nil, err
+			}
+			return NewTotp(secret, int(e.Period), int(e.Digits), e.Hash.New), nil
+		},
+		Option:   "totp",
+		Editable: true,
+		UriType:  "totp",
+	})
+}
+
 type Totp struct {
 	Secret []byte
 	Period int64
 	Digits int
-	hasher func() hash.Hash
+	// Alphabet is used instead of decimal digits if set, see Steam
+	Alphabet string
+	hasher   func() hash.Hash
 }
 
 func NewTotp(secret []byte, period, digits int, hasher func() hash.Hash) *Totp {
@@ -23,6 +41,13 @@ func NewTotp(secret []byte, period, digits int, hasher func() hash.Hash) *Totp {
 
 // HOTP according to RFC 4226
 func (t Totp) hotp(counter int64) uint32 {
+	// Step 3: Convert to number:
+	mod := digitsToMod(t.Digits)
+	return t.truncate(counter) % mod
+}
+
+// truncate does step 1 and 2 of HOTP, the HMAC and the dynamic truncation to 31 bits
+func (t Totp) truncate(counter int64) uint32 {
 	// Step 1: Generate an HMAC-SHA-x value Let HS = HMAC-SHA-x(K,C)  // HS
 	mac := hmac.New(t.hasher, t.Secret)
 
@@ -30,33 +55,77 @@ func (t Totp) hotp(counter int64) uint32 {
 	binary.BigEndian.PutUint64(asBin, uint64(counter))
 	mac.Write(asBin)
 
-	hash := mac.Sum(nil)
-
 	// Step 2: dynamic truncation to 4 bytes
+	return dynamicTruncate(mac.Sum(nil))
+}
+
+// dynamicTruncate picks 31 bits from the HMAC, see RFC 4226 section 5.3
+func dynamicTruncate(hash []byte) uint32 {
 	offset := hash[len(hash)-1] & 15
 	hash = hash[offset : offset+4]
-
-	// Step 3: Convert to number:
-	mod := digitsToMod(t.Digits)
-	num := binary.BigEndian.Uint32(hash) & 0x7FFF_FFFF
-	return num % mod
+	return binary.BigEndian.Uint32(hash) & 0x7FFF_FFFF
 }
 
 func (t Totp) totp(counter int64) uint32 {
 	return t.hotp(counter)
 }
 
-func (t Totp) Generate() (int, string) {
-	now := tx()
-	counter := now / t.Period
-	timeleft := int(t.Period - now%t.Period)
+// Generate returns the code at a time and the seconds until it expires
+func (t Totp) Generate(at time.Time) (int, string) {
+	return GenerateCode(t, at)
+}
+
+// Verify checks a code at time t, see VerifyCode
+func (t Totp) Verify(code string, at time.Time, window int) (int64, int, bool) {
+	return VerifyCode(t, code, at, window)
+}
+
+// Counter returns the time step at a time
+func (t Totp) Counter(at time.Time) int64 {
+	return at.Unix() / t.Period
+}
+
+// Validity returns the time span where the code for a counter is valid
+func (t Totp) Validity(counter int64) (time.Time, time.Time) {
+	return stepValidity(counter, t.Period)
+}
+
+func (t Totp) CounterBased() bool {
+	return false
+}
+
+// Hints splits the code in two halves, Steam codes are shown as is
+func (t Totp) Hints() DisplayHints {
+	if t.Alphabet != "" {
+		return DisplayHints{}
+	}
+	return groupHint(t.Digits)
+}
+
+// Code returns the zero-padded code for a counter
+func (t Totp) Code(counter int64) string {
+	if t.Alphabet != "" {
+		return encodeAlphabet(t.truncate(counter), t.Alphabet, t.Digits)
+	}
+
 	kod := fmt.Sprintf("%d", t.totp(counter))
 
 	// There is probably a better printf formatter for this...
 	for len(kod) < t.Digits {
 		kod = "0" + kod
 	}
-	return timeleft, kod
+	return kod
+}
+
+// encodeAlphabet converts a number to n symbols, least significant first
+func encodeAlphabet(num uint32, alphabet string, n int) string {
+	ret := make([]byte, n)
+	size := uint32(len(alphabet))
+	for i := range ret {
+		ret[i] = alphabet[num%size]
+		num /= size
+	}
+	return string(ret)
 }
 
 // helper to return the mod value for a number of digits
@@ -65,11 +134,6 @@ func digitsToMod(d int) uint32 {
 	return POW10[d]
 }
 
-// helper function to get the required time
-func tx() int64 {
-	return time.Now().Unix()
-}
-
 func secretFromBase64(str string) ([]byte, error) {
 	str = strings.Replace(str, " ", "", -1)
 	for len(str)%8 != 0 {
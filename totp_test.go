@@ -5,6 +5,7 @@ import (
 	"crypto"
 	"crypto/sha1"
 	"testing"
+	"time"
 )
 
 func TestHotp(t *testing.T) {
@@ -32,7 +33,7 @@ func TestHotp(t *testing.T) {
 }
 
 func TestTotp(t *testing.T) {
-	// test vectors from RFC 6248
+	// test vectors from RFC 6238
 	const SECRET1 = "12345678901234567890"
 	const SECRET256 = SECRET1 + "123456789012"
 	const SECRET512 = SECRET1 + SECRET1 + SECRET1 + "1234"
@@ -90,3 +91,56 @@ func TestSecret(t *testing.T) {
 		t.Errorf("Incorrect secret, wanted %v got %v", SECRET, secret)
 	}
 }
+
+func TestVerify(t *testing.T) {
+	// test vectors from RFC 6238: code 94287082 is valid for time 59 (counter 1)
+	totp := NewTotp([]byte("12345678901234567890"), DEFAULT_PERIOD, 8, sha1.New)
+
+	tests := []struct {
+		time   int64
+		window int
+		ok     bool
+		drift  int
+	}{
+		{59, 0, true, 0},
+		{30, 0, true, 0},
+		{89, 0, false, 0},
+		{89, 1, true, -1},
+		{0, 1, true, 1},
+		{150, 2, false, 0},
+		{150, 4, true, -4},
+	}
+
+	for _, test := range tests {
+		counter, drift, ok := totp.Verify("94287082", time.Unix(test.time, 0), test.window)
+		if ok != test.ok || drift != test.drift || (ok && counter != 1) {
+			t.Errorf("Verify at %d window %d: expected %v/%d got %v/%d (counter %d)",
+				test.time, test.window, test.ok, test.drift, ok, drift, counter)
+		}
+	}
+
+	if _, _, ok := totp.Verify("94287083", time.Unix(59, 0), 1); ok {
+		t.Errorf("Verify accepted wrong code")
+	}
+	if _, _, ok := totp.Verify("", time.Unix(59, 0), 1); ok {
+		t.Errorf("Verify accepted empty code")
+	}
+}
+
+func TestGenerateAt(t *testing.T) {
+	totp := NewTotp([]byte("12345678901234567890"), DEFAULT_PERIOD, 8, sha1.New)
+
+	// RFC 6238 test vector at 2005-03-18 01:58:29 UTC
+	at := time.Unix(1111111109, 0)
+	if timeleft, code := totp.Generate(at); code != "07081804" || timeleft != 1 {
+		t.Errorf("expected 07081804 with 1s left, got %s with %ds", code, timeleft)
+	}
+
+	from, until := totp.Validity(at.Unix() / totp.Period)
+	if from.Unix() != 1111111080 || until.Unix() != 1111111110 {
+		t.Errorf("unexpected validity %v - %v", from, until)
+	}
+	if _, code := totp.Generate(until); code != "14050471" {
+		t.Errorf("expected next code 14050471 got %s", code)
+	}
+}
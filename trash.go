@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TRASH_DEFAULT_DAYS = 30
+	TRASH_MAX_ITEMS    = 1000
+
+	TOMBSTONE_MAX_ITEMS = 100000
+)
+
+// Tombstone remembers a purged entry, so that merging doesn't bring it back
+type Tombstone struct {
+	Id      string
+	Deleted int64
+}
+
+// TrashItem is a removed entry, it can be restored until it is purged
+type TrashItem struct {
+	Entry   *Entry
+	Deleted int64 // time of removal, in microseconds like Entry.Added
+}
+
+// Expires returns when the item will be purged, or zero time if it is kept until purged by hand
+func (t TrashItem) Expires(days uint32) time.Time {
+	if days == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(t.Deleted).AddDate(0, 0, int(days))
+}
+
+func (t TrashItem) Date() string {
+	return time.UnixMicro(t.Deleted).Format("2006-01-02 15:04:05")
+}
+
+// Delete moves an entry from the database to the trash (but doesn't save it).
+// When the trash is full the oldest items are purged
+func (db *Database) Delete(entry *Entry) error {
+	for i, e := range db.Entries {
+		if e == entry {
+			db.Entries = append(db.Entries[:i], db.Entries[i+1:]...)
+			db.Trash = append(db.Trash, &TrashItem{Entry: e, Deleted: time.Now().UnixMicro()})
+			db.Record(JOURNAL_REMOVE, e)
+			for len(db.Trash) > TRASH_MAX_ITEMS {
+				db.bury(db.Trash[0])
+				db.Trash = db.Trash[1:]
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("'%s' is not in the database", entry.Name)
+}
+
+// Restore moves an item from the trash back to the end of the entries. The
+// entry counts as modified, so that merging doesn't remove it again
+func (db *Database) Restore(item *TrashItem) error {
+	if db.findExact(item.Entry.Name) != nil {
+		return fmt.Errorf("Item '%s' already exists, rename or remove it first", item.Entry.Name)
+	}
+	if err := db.checkRoom(1); err != nil {
+		return err
+	}
+	if !db.removeTrash(item) {
+		return fmt.Errorf("'%s' is not in the trash", item.Entry.Name)
+	}
+	db.assignId(item.Entry)
+	item.Entry.Modified = time.Now().UnixMicro()
+	db.Entries = append(db.Entries, item.Entry)
+	db.Record(JOURNAL_RESTORE, item.Entry)
+	return nil
+}
+
+// Purge removes an item from the trash for good
+func (db *Database) Purge(item *TrashItem) error {
+	if !db.removeTrash(item) {
+		return fmt.Errorf("'%s' is not in the trash", item.Entry.Name)
+	}
+	db.bury(item)
+	return nil
+}
+
+// PurgeAll removes all items from the trash for good
+func (db *Database) PurgeAll() {
+	for _, item := range db.Trash {
+		db.bury(item)
+	}
+	db.Trash = nil
+}
+
+// bury records a purged item and leaves a tombstone
+func (db *Database) bury(item *TrashItem) {
+	db.addTombstone(Tombstone{Id: item.Entry.Id, Deleted: item.Deleted})
+	db.Record(JOURNAL_PURGE, item.Entry)
+}
+
+// addTombstone adds a tombstone, the oldest ones are dropped when there are too many
+func (db *Database) addTombstone(t Tombstone) {
+	db.Tombstones = append(db.Tombstones, t)
+	if n := len(db.Tombstones) - TOMBSTONE_MAX_ITEMS; n > 0 {
+		db.Tombstones = db.Tombstones[n:]
+	}
+}
+
+// purgeExpired removes the items that have been in the trash longer than TrashDays
+func (db *Database) purgeExpired(now time.Time) {
+	var kept []*TrashItem
+	for _, item := range db.Trash {
+		if expires := item.Expires(db.TrashDays); expires.IsZero() || now.Before(expires) {
+			kept = append(kept, item)
+		} else {
+			db.bury(item)
+		}
+	}
+	db.Trash = kept
+}
+
+func (db *Database) removeTrash(item *TrashItem) bool {
+	for i, t := range db.Trash {
+		if t == item {
+			db.Trash = append(db.Trash[:i], db.Trash[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// FindTrash finds items in the trash, either by index in format "#<number>",
+// exact name or fuzzy search. Several items may have the same name
+func (db Database) FindTrash(name string) ([]*TrashItem, error) {
+	if strings.HasPrefix(name, "#") {
+		idx, err := strconv.ParseInt(name[1:], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s: %v", name, err)
+		}
+		if idx < 1 || int(idx) > len(db.Trash) {
+			return nil, fmt.Errorf("Trash item %s does not exist", name)
+		}
+		return []*TrashItem{db.Trash[idx-1]}, nil
+	}
+
+	var ret []*TrashItem
+	for _, item := range db.Trash {
+		if strings.EqualFold(item.Entry.Name, name) {
+			ret = append(ret, item)
+		}
+	}
+	if ret != nil {
+		return ret, nil
+	}
+
+	entries := make([]*Entry, len(db.Trash))
+	for i, item := range db.Trash {
+		entries[i] = item.Entry
+	}
+	for _, m := range rank(entries, name) {
+		for _, item := range db.Trash {
+			if item.Entry == m.Entry {
+				ret = append(ret, item)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// writeTrash writes the retention time and the trash items
+func writeTrash(w io.Writer, days uint32, trash []*TrashItem) error {
+	if err := WriteMultiple(w, BYTE_ORDER, days, uint32(len(trash))); err != nil {
+		return err
+	}
+	for _, item := range trash {
+		if err := WriteOne(w, BYTE_ORDER, item.Deleted); err != nil {
+			return err
+		}
+		if err := item.Entry.Serial(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTombstones(w io.Writer, tombstones []Tombstone) error {
+	if err := WriteOne(w, BYTE_ORDER, uint32(len(tombstones))); err != nil {
+		return err
+	}
+	for _, t := range tombstones {
+		if err := WriteMultiple(w, BYTE_ORDER, t.Id, t.Deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTombstones(r io.Reader) ([]Tombstone, error) {
+	var count uint32
+	if err := ReadOne(r, BYTE_ORDER, &count); err != nil {
+		return nil, err
+	}
+	if count > TOMBSTONE_MAX_ITEMS {
+		return nil, fmt.Errorf("Too many tombstones: %d", count)
+	}
+	tombstones := make([]Tombstone, count)
+	for i := range tombstones {
+		if err := ReadMultiple(r, BYTE_ORDER, &tombstones[i].Id, &tombstones[i].Deleted); err != nil {
+			return nil, err
+		}
+	}
+	return tombstones, nil
+}
+
+// readTrash reads what writeTrash wrote, the entries are in the given database version
+func readTrash(r io.Reader, version uint32) (uint32, []*TrashItem, error) {
+	var days, count uint32
+	if err := ReadMultiple(r, BYTE_ORDER, &days, &count); err != nil {
+		return 0, nil, err
+	}
+	if count > TRASH_MAX_ITEMS {
+		return 0, nil, fmt.Errorf("Too many items in trash: %d", count)
+	}
+
+	var trash []*TrashItem
+	for i := 0; i < int(count); i++ {
+		item := &TrashItem{Entry: &Entry{}}
+		if err := ReadOne(r, BYTE_ORDER, &item.Deleted); err != nil {
+			return 0, nil, err
+		}
+		if err := item.Entry.Deserial(r, version); err != nil {
+			return 0, nil, err
+		}
+		trash = append(trash, item)
+	}
+	return days, trash, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	db := &Database{TrashDays: TRASH_DEFAULT_DAYS}
+	e1 := add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+	e2 := add(db, "entry 2", "M5UXMZJAPFXXKIDVOA")
+
+	if err := db.Delete(e1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := db.Delete(e1); err == nil {
+		t.Errorf("Deleted entry was deleted again")
+	}
+	if len(db.Entries) != 1 || len(db.Trash) != 1 || db.Trash[0].Entry != e1 {
+		t.Fatalf("Entry was not moved to the trash")
+	}
+
+	// a new entry with the same name blocks the restore
+	e3 := add(db, "entry 1", "M5UXMZJAPFXXKIDVOA")
+	items, err := db.FindTrash("entry 1")
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Trash item not found: %v", err)
+	}
+	if err := db.Restore(items[0]); err == nil {
+		t.Errorf("Restore replaced an existing entry")
+	}
+	db.Delete(e3)
+
+	items, err = db.FindTrash("entry 1")
+	if err != nil || len(items) != 2 {
+		t.Fatalf("Both trash items were not found: %v", err)
+	}
+	if items, err := db.FindTrash("#2"); err != nil || items[0].Entry != e3 {
+		t.Errorf("Trash item not found by index: %v", err)
+	}
+	if err := db.Restore(db.Trash[0]); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if len(db.Entries) != 2 || db.Entries[1] != e1 || db.Entries[0] != e2 {
+		t.Errorf("Entry was not restored: %v", db.Entries)
+	}
+
+	if err := db.Purge(db.Trash[0]); err != nil || len(db.Trash) != 0 {
+		t.Errorf("Purge failed: %v", err)
+	}
+}
+
+func TestTrashExpiry(t *testing.T) {
+	db := &Database{TrashDays: 2}
+	e1 := add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+	e2 := add(db, "entry 2", "M5UXMZJAPFXXKIDVOA")
+	db.Delete(e1)
+	db.Delete(e2)
+
+	now := time.Now()
+	db.Trash[0].Deleted = now.AddDate(0, 0, -3).UnixMicro()
+	db.purgeExpired(now)
+	if len(db.Trash) != 1 || db.Trash[0].Entry != e2 {
+		t.Errorf("Expired item was not purged")
+	}
+
+	db.TrashDays = 0
+	db.purgeExpired(now.AddDate(10, 0, 0))
+	if len(db.Trash) != 1 {
+		t.Errorf("Item was purged without retention")
+	}
+}
+
+func TestTrashFull(t *testing.T) {
+	db := &Database{}
+	for i := 0; i < TRASH_MAX_ITEMS; i++ {
+		db.Trash = append(db.Trash, &TrashItem{Entry: &Entry{Id: newEntryId()}, Deleted: int64(i)})
+	}
+	oldest := db.Trash[0]
+	e1 := add(db, "entry 1", "NZSXMZLSEBTW63TOME")
+	if err := db.Delete(e1); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	if len(db.Trash) != TRASH_MAX_ITEMS || db.Trash[0].Deleted != 1 || db.Trash[len(db.Trash)-1].Entry != e1 {
+		t.Errorf("Oldest item was not purged, %d items", len(db.Trash))
+	}
+	if db.findTombstone(oldest.Entry.Id) == nil {
+		t.Errorf("Purged item has no tombstone")
+	}
+}
+
+func TestTrashSaveLoad(t *testing.T) {
+	filename := t.TempDir() + "/test.tokdb"
+	db1 := ensure(CreateDatabase(filename, "password"))
+	e1 := add(db1, "entry 1", "NZSXMZLSEBTW63TOME")
+	db1.Delete(e1)
+	db1.TrashDays = 7
+	if err := db1.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	db2 := ensure(LoadDatabase(filename, "password"))
+	if db2.TrashDays != 7 || len(db2.Trash) != 1 || db2.Trash[0].Deleted != db1.Trash[0].Deleted ||
+		db2.Trash[0].Entry.Id != e1.Id || db2.Trash[0].Entry.Secret != e1.Secret {
+		t.Errorf("Loaded trash differs: %v", db2.Trash)
+	}
+}
+
+func TestTombstonesFull(t *testing.T) {
+	filename := t.TempDir() + "/test.tokdb"
+	db1 := ensure(CreateDatabase(filename, "password"))
+	for i := 0; i < TOMBSTONE_MAX_ITEMS; i++ {
+		db1.Tombstones = append(db1.Tombstones, Tombstone{Id: newEntryId(), Deleted: int64(i)})
+	}
+	oldest := db1.Tombstones[0]
+	e1 := add(db1, "entry 1", "NZSXMZLSEBTW63TOME")
+	db1.Delete(e1)
+	db1.PurgeAll()
+	if err := db1.Save(); err != nil {
+		t.Fatalf("Unable to save database: %v", err)
+	}
+
+	db2, err := LoadDatabase(filename, "password")
+	if err != nil {
+		t.Fatalf("Unable to load database: %v", err)
+	}
+	if len(db2.Tombstones) != TOMBSTONE_MAX_ITEMS || db2.findTombstone(e1.Id) == nil || db2.findTombstone(oldest.Id) != nil {
+		t.Errorf("Oldest tombstone was not dropped, %d tombstones", len(db2.Tombstones))
+	}
+}
@@ -0,0 +1,99 @@
+// Yandex Key codes.
+//
+// Yandex Key mixes the PIN into the key: the HMAC-SHA256 key is SHA256(PIN + secret),
+// without its first byte if that is zero. The code is 8 lower case letters from 63 bits
+// of the HMAC of the time step, using the usual dynamic truncation offset.
+
+package main
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	YANDEX_PERIOD      = 30
+	YANDEX_DIGITS      = 8
+	YANDEX_SECRET_SIZE = 16
+	YANDEX_ALPHABET    = "abcdefghijklmnopqrstuvwxyz"
+)
+
+func init() {
+	RegisterGenerator(ENTRY_YANDEX, GeneratorType{
+		Name: "Yandex Key",
+		New: func(e Entry) (Generator, error) {
+			secret, err := secretFromBase64(e.Secret)
+			if err != nil {
+				return nil, err
+			}
+			return NewYandex(secret, e.Pin)
+		},
+		Option:    "yandex",
+		Period:    YANDEX_PERIOD,
+		Digits:    YANDEX_DIGITS,
+		Hash:      crypto.SHA256,
+		PinInCode: true,
+	})
+}
+
+// Yandex is a Yandex Key generator
+type Yandex struct {
+	key []byte
+}
+
+// NewYandex creates a Yandex Key generator, only the first 16 bytes of the secret are used
+func NewYandex(secret []byte, pin string) (*Yandex, error) {
+	if len(secret) < YANDEX_SECRET_SIZE {
+		return nil, fmt.Errorf("Invalid Yandex secret, expected at least %d bytes", YANDEX_SECRET_SIZE)
+	}
+	if pin == "" {
+		return nil, fmt.Errorf("Yandex Key requires a PIN")
+	}
+
+	key := sha256.Sum256(append([]byte(pin), secret[:YANDEX_SECRET_SIZE]...))
+	if key[0] == 0 {
+		return &Yandex{key: key[1:]}, nil
+	}
+	return &Yandex{key: key[:]}, nil
+}
+
+// Counter returns the time step at a time
+func (y Yandex) Counter(at time.Time) int64 {
+	return at.Unix() / YANDEX_PERIOD
+}
+
+// Validity returns the time span where the code for a counter is valid
+func (y Yandex) Validity(counter int64) (time.Time, time.Time) {
+	return stepValidity(counter, YANDEX_PERIOD)
+}
+
+func (y Yandex) CounterBased() bool {
+	return false
+}
+
+func (y Yandex) Hints() DisplayHints {
+	return groupHint(YANDEX_DIGITS)
+}
+
+// Code returns the code for a counter
+func (y Yandex) Code(counter int64) string {
+	mac := hmac.New(sha256.New, y.key)
+	binary.Write(mac, binary.BigEndian, counter)
+	hash := mac.Sum(nil)
+
+	offset := hash[len(hash)-1] & 15
+	num := binary.BigEndian.Uint64(hash[offset:offset+8]) & 0x7FFF_FFFF_FFFF_FFFF
+
+	// most significant letter first
+	num %= 208827064576 // 26^8
+	ret := make([]byte, YANDEX_DIGITS)
+	for i := len(ret) - 1; i >= 0; i-- {
+		ret[i] = YANDEX_ALPHABET[num%26]
+		num /= 26
+	}
+	return string(ret)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestYandex(t *testing.T) {
+	// test vectors from the Aegis Yandex Key implementation
+	tests := []struct {
+		pin    string
+		secret string
+		time   int64
+		code   string
+	}{
+		{"5239", "6SB2IKNM6OBZPAVBVTOHDKS4FAAAAAAADFUTQMBTRY", 1641559648, "umozdicq"},
+		{"7586", "LA2V6KMCGYMWWVEW64RNP3JA3IAAAAAAHTSG4HRZPI", 1581064020, "oactmacq"},
+		{"7586", "LA2V6KMCGYMWWVEW64RNP3JA3IAAAAAAHTSG4HRZPI", 1581090810, "wemdwrix"},
+		{"5210481216086702", "JBGSAU4G7IEZG6OY4UAXX62JU4AAAAAAHTSG4HXU3M", 1581091469, "dfrpywob"},
+		{"5210481216086702", "JBGSAU4G7IEZG6OY4UAXX62JU4AAAAAAHTSG4HXU3M", 1581093059, "vunyprpd"},
+	}
+
+	for _, test := range tests {
+		entry, err := NewTypedEntry(ENTRY_YANDEX, "yandex", test.secret, DEFAULT_HASH, "", test.pin, DEFAULT_PERIOD, DEFAULT_DIGITS)
+		if err != nil {
+			t.Errorf("Could not create entry: %v", err)
+			continue
+		}
+		g := ensure(entry.Generator())
+		if _, code := GenerateCode(g, time.Unix(test.time, 0)); code != test.code {
+			t.Errorf("Yandex %s at %d: expected %s got %s", test.secret, test.time, test.code, code)
+		}
+	}
+}